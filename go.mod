@@ -4,5 +4,7 @@ go 1.25.5
 
 require (
 	github.com/klauspost/compress v1.18.6
+	golang.org/x/sys v0.38.0
+	golang.org/x/term v0.37.0
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -14,15 +14,38 @@ const version = "1.2.3"
 var self = ""
 
 func main() {
-	path, narg, marg, qarg, split, anypath, compress, force := "", 0, 0, 0, false, false, false, false
+	path, narg, marg, qarg, iarg, warg, parg, targ, split, anypath, compress, force := "", 0, 0, 0, 0, 0, 0, 0, false, false, false, false
+	policy, mode, direct, extract, xarg, dest, carg := "", "", false, "", 0, ".", 0
+	name, namearg, stdout := "", 0, false
+	envname, envarg, fd := "", 0, false
+	outdir, oarg, template, tmplarg := "", 0, "", 0
+	output, outarg, collision := "", 0, ""
+	var perm os.FileMode
+	modearg, preserve := 0, false
+	var capture commands.Capture                                                    // Metadata to record beyond permissions and mtime
+	var command []string                                                            // Command to run with -e/--exec
+	var more []string                                                               // Further files to split into one set with the first
+	action, actionflag := "", ""                                                    // Action on a directory of horcrux-files other than merging
+	fileactions := map[string]bool{"update": true, "apply": true, "subshare": true} // Actions on a single horcrux-file
+	setAction := func(a, flag string) {
+		if action != "" && action != a {
+			usage(nil, "Flags "+actionflag+" and "+flag+" can't be used together")
+		}
+		action, actionflag = a, flag
+	}
 	var err error
-	var n, m int
+	var n, m, i, t, points int
+	var weights []int
 	for _, arg := range os.Args {
 		if self == "" {
 			selves := strings.Split(arg, "/")
 			self = selves[len(selves)-1]
 			continue
 		}
+		if action == "exec" && anypath { // The command after -e/--exec and --
+			command = append(command, arg)
+			continue
+		}
 		if narg == 1 { // after -n
 			if qarg > 0 {
 				usage(nil, "Flag -q/--query can't be used with other flags")
@@ -32,8 +55,8 @@ func main() {
 			if err != nil {
 				usage(err, "Argument of -n/--number should be an integer: '"+arg+"'")
 			}
-			if n < 1 {
-				usage(nil, "Argument of -n/--number should be 1 or more")
+			if n < 1 || n > 65535 {
+				usage(nil, "Argument of -n/--number should be 1..65535")
 			}
 			continue
 		}
@@ -51,8 +74,133 @@ func main() {
 			}
 			continue
 		}
+		if iarg == 1 { // after -i
+			if qarg > 0 {
+				usage(nil, "Flag -q/--query can't be used with other flags")
+			}
+			iarg = 2
+			i, err = strconv.Atoi(arg)
+			if err != nil {
+				usage(err, "Argument of -i/--issue should be an integer: '"+arg+"'")
+			}
+			if i < 1 || i > 255 {
+				usage(nil, "Argument of -i/--issue should be 1..255")
+			}
+			continue
+		}
+		if warg == 1 { // after -w
+			if qarg > 0 {
+				usage(nil, "Flag -q/--query can't be used with other flags")
+			}
+			warg = 2
+			for _, w := range strings.Split(arg, ",") {
+				weight, err := strconv.Atoi(w)
+				if err != nil {
+					usage(err, "Argument of -w/--weights should be comma-separated integers: '"+arg+"'")
+				}
+				if weight < 1 {
+					usage(nil, "Weights of -w/--weights should be 1 or more")
+				}
+				weights = append(weights, weight)
+				points += weight
+			}
+			continue
+		}
+		if targ == 1 { // after -t
+			if qarg > 0 {
+				usage(nil, "Flag -q/--query can't be used with other flags")
+			}
+			targ = 2
+			t, err = strconv.Atoi(arg)
+			if err != nil {
+				usage(err, "Argument of -t/--privacy should be an integer: '"+arg+"'")
+			}
+			if t < 1 {
+				usage(nil, "Argument of -t/--privacy should be 1 or more")
+			}
+			continue
+		}
+		if xarg == 1 { // after -x
+			if qarg > 0 {
+				usage(nil, "Flag -q/--query can't be used with other flags")
+			}
+			xarg = 2
+			extract = arg
+			continue
+		}
+		if carg == 1 { // after -C
+			if qarg > 0 {
+				usage(nil, "Flag -q/--query can't be used with other flags")
+			}
+			carg = 2
+			dest = arg
+			continue
+		}
+		if namearg == 1 { // after -N
+			if qarg > 0 {
+				usage(nil, "Flag -q/--query can't be used with other flags")
+			}
+			namearg = 2
+			name = arg
+			continue
+		}
+		if envarg == 1 { // after -E
+			if qarg > 0 {
+				usage(nil, "Flag -q/--query can't be used with other flags")
+			}
+			envarg = 2
+			envname = arg
+			if envname == "" || strings.ContainsAny(envname, "=\x00") {
+				usage(nil, "Argument of -E/--env should be the name of an environment variable: '"+arg+"'")
+			}
+			continue
+		}
+		if oarg == 1 { // after -o
+			if qarg > 0 {
+				usage(nil, "Flag -q/--query can't be used with other flags")
+			}
+			oarg = 2
+			outdir = arg
+			continue
+		}
+		if tmplarg == 1 { // after -T
+			if qarg > 0 {
+				usage(nil, "Flag -q/--query can't be used with other flags")
+			}
+			tmplarg = 2
+			template = arg
+			continue
+		}
+		if outarg == 1 { // after -O
+			if qarg > 0 {
+				usage(nil, "Flag -q/--query can't be used with other flags")
+			}
+			outarg = 2
+			output = arg
+			continue
+		}
+		if modearg == 1 { // after -M
+			if qarg > 0 {
+				usage(nil, "Flag -q/--query can't be used with other flags")
+			}
+			modearg = 2
+			mode, err := strconv.ParseUint(arg, 8, 32)
+			if err != nil || mode == 0 || mode > 0777 {
+				usage(err, "Argument of -M/--mode should be octal permissions like 600: '"+arg+"'")
+			}
+			perm = os.FileMode(mode)
+			continue
+		}
+		if parg == 1 { // after -p
+			if qarg > 0 {
+				usage(nil, "Flag -q/--query can't be used with other flags")
+			}
+			parg = 2
+			policy = arg
+			continue
+		}
 		if qarg == 1 { // after -q
-			if marg > 0 || narg > 0 {
+			if marg > 0 || narg > 0 || iarg > 0 || warg > 0 || parg > 0 || targ > 0 || xarg > 0 || carg > 0 || namearg > 0 || envarg > 0 || oarg > 0 || tmplarg > 0 || outarg > 0 || modearg > 0 {
 				usage(nil, "Flag -q/--query can't be used with other flags")
 			}
 			qarg = 2
@@ -69,6 +217,27 @@ func main() {
 			force = true
 		case "-z", "--zstd":
 			compress = true
+		case "-d", "--drill":
+			setAction("drill", "-d/--drill")
+		case "-r", "--reshare":
+			setAction("reshare", "-r/--reshare")
+		case "-k", "--rekey":
+			setAction("rekey", "-k/--rekey")
+		case "-u", "--update":
+			setAction("update", "-u/--update")
+		case "-a", "--apply":
+			setAction("apply", "-a/--apply")
+		case "-s", "--subshare":
+			setAction("subshare", "-s/--subshare")
+		case "-e", "--exec":
+			setAction("exec", "-e/--exec")
+		case "-E", "--env":
+			if envarg > 0 {
+				usage(nil, "Multiple '-E/--env' flags")
+			}
+			envarg = 1
+		case "-F", "--fd":
+			fd = true
 		case "-n", "--number":
 			split = true
 			if narg > 0 {
@@ -81,6 +250,84 @@ func main() {
 				usage(nil, "Multiple '-m/--minimum' flags")
 			}
 			marg = 1
+		case "-w", "--weights":
+			split = true
+			if warg > 0 {
+				usage(nil, "Multiple '-w/--weights' flags")
+			}
+			warg = 1
+		case "-p", "--policy":
+			split = true
+			if parg > 0 {
+				usage(nil, "Multiple '-p/--policy' flags")
+			}
+			parg = 1
+		case "-t", "--privacy":
+			split = true
+			if targ > 0 {
+				usage(nil, "Multiple '-t/--privacy' flags")
+			}
+			targ = 1
+			mode = commands.ModeRamp
+		case "-D", "--direct":
+			split = true
+			direct = true
+		case "-x", "--extract":
+			if xarg > 0 {
+				usage(nil, "Multiple '-x/--extract' flags")
+			}
+			xarg = 1
+		case "-C", "--directory":
+			if carg > 0 {
+				usage(nil, "Multiple '-C/--directory' flags")
+			}
+			carg = 1
+		case "-N", "--name":
+			if namearg > 0 {
+				usage(nil, "Multiple '-N/--name' flags")
+			}
+			namearg = 1
+		case "-o", "--outdir":
+			if oarg > 0 {
+				usage(nil, "Multiple '-o/--outdir' flags")
+			}
+			oarg = 1
+		case "-T", "--template":
+			if tmplarg > 0 {
+				usage(nil, "Multiple '-T/--template' flags")
+			}
+			tmplarg = 1
+		case "-O", "--output":
+			if outarg > 0 {
+				usage(nil, "Multiple '-O/--output' flags")
+			}
+			outarg = 1
+		case "--overwrite", "--no-clobber", "--suffix":
+			if collision != "" && collision != arg[2:] {
+				usage(nil, "Flags --"+collision+" and "+arg+" can't be used together")
+			}
+			collision = arg[2:]
+		case "-M", "--mode":
+			if modearg > 0 {
+				usage(nil, "Multiple '-M/--mode' flags")
+			}
+			modearg = 1
+		case "-X", "--xattrs":
+			split = true
+			capture.Xattrs = true
+		case "-U", "--owner":
+			split = true
+			capture.Owner = true
+		case "-P", "--preserve":
+			preserve = true
+		case "-c", "--stdout":
+			stdout = true
+		case "-i", "--issue":
+			if iarg > 0 {
+				usage(nil, "Multiple '-i/--issue' flags")
+			}
+			iarg = 1
+			setAction("issue", "-i/--issue")
 		case "-q", "--query":
 			if qarg > 0 {
 				usage(nil, "Multiple '-q/--query' flags")
@@ -93,18 +340,91 @@ func main() {
 			if arg == "--" {
 				anypath = true
 			} else {
-				if !anypath && arg[0] == '-' {
+				if !anypath && arg[0] == '-' && arg != "-" {
 					usage(nil, "Unknown flag: "+arg)
 				}
 				if len(path) > 0 {
-					usage(nil, "Redundant argument '"+arg+"' after '"+path+"'")
+					more = append(more, arg)
+				} else {
+					path = arg
 				}
-				path = arg
 			}
 		}
 	}
-	if path == "" { // No file/directory given
-		if split || qarg > 0 {
+	if len(more) > 0 { // Several files to split into one set
+		if action != "" || qarg > 0 || xarg > 0 {
+			usage(nil, "Redundant argument '"+more[0]+"' after '"+path+"'")
+		}
+		if mode != "" || direct {
+			usage(nil, "Flags -t/--privacy and -D/--direct can only be used on a single file")
+		}
+		for _, p := range append([]string{path}, more...) {
+			fi, err := os.Stat(p)
+			if err != nil || fi.IsDir() {
+				usage(nil, "Not a file: "+p)
+			}
+		}
+		split = true
+	}
+	if action == "exec" {
+		if len(command) == 0 {
+			usage(nil, "Flag -e/--exec needs a command after '--'")
+		}
+		if envarg > 0 && fd {
+			usage(nil, "Flags -E/--env and -F/--fd can't be used together")
+		}
+	} else if envarg > 0 || fd {
+		usage(nil, "Flags -E/--env and -F/--fd can only be used with -e/--exec")
+	}
+	if xarg > 0 && (split || (action != "" && action != "exec")) {
+		usage(nil, "Flag -x/--extract can only be used when reconstructing")
+	}
+	if carg > 0 && (split || action != "") {
+		usage(nil, "Flag -C/--directory can only be used when reconstructing")
+	}
+	if (outarg > 0 || collision != "") && (split || action != "" || stdout) {
+		usage(nil, "Flags -O/--output, --overwrite, --no-clobber and --suffix can only be used when reconstructing to disk")
+	}
+	if preserve && (split || action != "" || stdout) {
+		usage(nil, "Flag -P/--preserve can only be used when reconstructing to disk")
+	}
+	if modearg > 0 && (stdout || (action != "" && action != "reshare" && action != "rekey")) {
+		usage(nil, "Flag -M/--mode can only be used when splitting, resharing, rekeying or reconstructing to disk")
+	}
+	if modearg > 0 && preserve {
+		usage(nil, "Flags -M/--mode and -P/--preserve can't be used together")
+	}
+	if (capture.Xattrs || capture.Owner) && (action != "" || path == "-") {
+		usage(nil, "Flags -X/--xattrs and -U/--owner can only be used when splitting files")
+	}
+	if outarg > 0 && carg > 0 {
+		usage(nil, "Flags -O/--output and -C/--directory can't be used together")
+	}
+	if fi, err := os.Stat(dest); carg > 0 && (err != nil || !fi.IsDir()) {
+		usage(nil, "Not a directory: "+dest)
+	}
+	if stdout && (split || action != "" || carg > 0) {
+		usage(nil, "Flag -c/--stdout can only be used when reconstructing, without -C/--directory")
+	}
+	if (oarg > 0 || tmplarg > 0) && !split && action != "reshare" && action != "rekey" && path != "-" {
+		usage(nil, "Flags -o/--outdir and -T/--template can only be used when splitting, resharing or rekeying")
+	}
+	if fi, err := os.Stat(outdir); oarg > 0 && (err != nil || !fi.IsDir()) {
+		usage(nil, "Not a directory: "+outdir)
+	}
+	if namearg > 0 && ((!split && path != "-") || action != "") {
+		usage(nil, "Flag -N/--name can only be used when splitting")
+	}
+	if path == "-" { // Standard input
+		if action != "" || qarg > 0 || len(more) > 0 {
+			usage(nil, "Standard input can only be a single file to split")
+		}
+		if name == "" {
+			usage(nil, "Splitting standard input needs a name for the file: -N/--name NAME")
+		}
+		split = true
+	} else if path == "" { // No file/directory given
+		if (split && action == "") || qarg > 0 || fileactions[action] {
 			usage(nil, "No file specified")
 		}
 		path = "."
@@ -112,13 +432,13 @@ func main() {
 		fi, err := os.Stat(path)
 		if err == nil { // The path exists
 			if fi.IsDir() { // Directory
-				if split {
-					usage(nil, "Can't split a directory")
-				}
-				if qarg > 0 {
+				if qarg > 0 || fileactions[action] {
 					usage(nil, "A horcrux can't be a directory")
 				}
 			} else { // File
+				if action != "" && !fileactions[action] {
+					usage(nil, "Flag "+actionflag+" needs a directory with horcrux-files, not a file")
+				}
 				if qarg > 0 { // Query
 					err = commands.Query(path)
 					if err != nil {
@@ -127,51 +447,232 @@ func main() {
 					}
 					return
 				}
-				split = true
+				if action == "" {
+					split = true
+				}
 			}
 		} else {
-			if split { // -n and/or -m given
+			if split && action == "" { // -n and/or -m given
 				usage(nil, "Not a file: "+path)
 			}
 			usage(nil, "Not a file/directory: "+path)
 		}
 	}
-	if split {
+	if direct {
+		if targ > 0 {
+			usage(nil, "Flags -t/--privacy and -D/--direct can't be used together")
+		}
+		mode = commands.ModeDirect
+	}
+	if mode != "" && action != "" {
+		usage(nil, "Flags -t/--privacy and -D/--direct can only be used when splitting a file")
+	}
+	if mode != "" && n > 255 {
+		usage(nil, "Flags -t/--privacy and -D/--direct need -n/--number to be 1..255")
+	}
+	if mode != "" && (warg > 0 || parg > 0) {
+		usage(nil, "Flags -t/--privacy and -D/--direct can't be used with -w/--weights or -p/--policy")
+	}
+	if split && action == "subshare" && (warg > 0 || parg > 0) {
+		usage(nil, "Flag -s/--subshare can't be used with -w/--weights or -p/--policy")
+	}
+	if split && action != "" && action != "reshare" && action != "rekey" && action != "subshare" {
+		usage(nil, "Flag "+actionflag+" can't be used with -n/--number, -m/--minimum, -w/--weights or -p/--policy")
+	}
+	if parg > 0 && (narg > 0 || marg > 0 || warg > 0) {
+		usage(nil, "Flag -p/--policy can't be used with -n/--number, -m/--minimum or -w/--weights")
+	}
+	if weights != nil {
+		if n > 0 && n != len(weights) {
+			usage(nil, "Argument of -n/--number should be the number of weights: "+fmt.Sprint(len(weights)))
+		}
+		if points > 65535 {
+			usage(nil, "The weights of -w/--weights should add up to 65535 or less")
+		}
+		if m > points {
+			usage(nil, "Argument of -m should be less or equal to the sum of the weights: "+fmt.Sprint(points))
+		}
+		n = len(weights)
+		if m == 0 { // default minimum is all
+			m = points
+		}
+	}
+	out := commands.Output{Dir: outdir, Template: template, Perm: perm, Compress: compress, Force: force}
+	switch action {
+	case "exec":
+		// The command gets standard output, messages go to standard error
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		err = commands.Exec(path, compress, extract, envname, fd, command, stdout)
+		if exitErr, ok := err.(interface{ ExitCode() int }); ok {
+			os.Exit(exitErr.ExitCode())
+		}
+		if err != nil {
+			fail(err, "Running '"+command[0]+"' with the file from directory '"+path+"' failed")
+		}
+		return
+	case "drill":
+		err = commands.Drill(path, compress)
+		if err != nil {
+			fail(err, "Drill in directory '"+path+"' failed")
+		}
+		return
+	case "issue":
+		err = commands.Issue(path, i, compress, force)
+		if err != nil {
+			fail(err, "Issuing horcrux-file in directory '"+path+"' failed")
+		}
+		return
+	case "update":
+		err = commands.Update(path, force)
+		if err != nil {
+			fail(err, "Generating refresh sub-updates for '"+path+"' failed")
+		}
+		return
+	case "apply":
+		err = commands.Apply(path)
+		if err != nil {
+			fail(err, "Applying refresh sub-updates to '"+path+"' failed")
+		}
+		return
+	case "subshare":
 		if n == 0 {
 			n = 2
 		}
+		if n > 255 {
+			usage(nil, "Argument of -n/--number for -s/--subshare should be 1..255")
+		}
 		if m > n {
 			usage(nil, "Argument of -m should be less or equal to "+fmt.Sprintf("%d", n))
 		}
 		if m == 0 { // default minimum is all
 			m = n
 		}
-		err = commands.Split(path, n, m, compress, force)
+		err = commands.Subshare(path, n, m, force)
 		if err != nil {
-			fmt.Println(err)
-			fmt.Println("Splitting file '"+path+"' failed")
+			fail(err, "Sub-sharing horcrux-file '"+path+"' failed")
+		}
+		return
+	case "reshare", "rekey":
+		if n > 0 && m > n && weights == nil {
+			usage(nil, "Argument of -m should be less or equal to "+fmt.Sprintf("%d", n))
+		}
+		if action == "reshare" {
+			err = commands.Reshare(path, n, m, weights, policy, out)
+		} else {
+			err = commands.Rekey(path, n, m, weights, policy, out)
+		}
+		if err != nil {
+			fail(err, "Failed to "+action+" horcrux-files in directory '"+path+"'")
+		}
+		return
+	}
+	if split {
+		if n == 0 {
+			n = 2
+		}
+		if m > n && weights == nil {
+			usage(nil, "Argument of -m should be less or equal to "+fmt.Sprintf("%d", n))
+		}
+		if m == 0 { // default minimum is all
+			m = n
+		}
+		if t > m {
+			usage(nil, "Argument of -t should be less or equal to "+fmt.Sprintf("%d", m))
+		}
+		if len(more) > 0 {
+			paths := append([]string{path}, more...)
+			err = commands.SplitSecrets(paths, n, m, weights, policy, capture, out)
+			if err != nil {
+				fail(err, "Splitting files '"+strings.Join(paths, "', '")+"' failed")
+			}
+			return
+		}
+		err = commands.Split(path, name, n, m, weights, policy, mode, t, capture, out)
+		if err != nil {
+			fail(err, "Splitting file '"+path+"' failed")
 		}
 		return
 	}
 	// Merge
-	err = commands.Merge(path, compress)
+	if stdout {
+		// Only the reconstructed file goes to standard output, messages to standard error
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		err = commands.Merge(path, compress, extract, commands.Target{Dest: dest, Stdout: stdout})
+		if err != nil {
+			fail(err, "Merge in directory '"+path+"' failed")
+		}
+		return
+	}
+	err = commands.Merge(path, compress, extract, commands.Target{Dest: dest, Output: output, Collision: collision, Perm: perm, Preserve: preserve})
 	if err != nil {
-		fmt.Println(err)
-		fmt.Println("Merge in directory '"+path+"' failed")
+		fail(err, "Merge in directory '"+path+"' failed")
 	}
 }
 
+// fail reports the failure of a command and exits with a non-zero code
+func fail(err error, message string) {
+	fmt.Println(err)
+	fmt.Println(message)
+	os.Exit(1)
+}
+
 func usage(e error, err string) {
 	fmt.Println(self + " v" + version + " - Split file into 'horcrux-files', reconstructable without key")
 	fmt.Println("Usage:")
 	fmt.Println("  -f/--force:  Created horcrux-files will overwrite existing files")
 	fmt.Println("  -z/--zstd:   Work with compressed .horcrux files instead of with .yml files")
-	fmt.Println("- Split & encrypt:  " + self + " [-z|--zstd] [-n|--number N] [-m|--minimum M] FILE")
-	fmt.Println("    N:     Number of horcrux-files to produce [1..255, default: 2]")
+	fmt.Println("- Split & encrypt:  " + self + " [-z|--zstd] [-n|--number N] [-m|--minimum M] [-w|--weights W,...] [-N|--name NAME] [-X|--xattrs] [-U|--owner] FILE...")
+	fmt.Println("    N:     Number of horcrux-files to produce [1..65535 (1..255 for -t/-D), default: 2]")
 	fmt.Println("    M:     Min.number of horcrux-files needed to reconstruct [1..N, default: N]")
-	fmt.Println("    FILE:  Original file to split up and encrypt")
-	fmt.Println("- Reconstruct file:  " + self + " [-z|--zstd] [DIR]")
+	fmt.Println("    W,...: Number of keyparts for each horcrux-file (65535 in all), M counts keyparts [default: all 1]")
+	fmt.Println("- Split without key (ramp):  " + self + " [-z|--zstd] [-n|--number N] [-m|--minimum M] -t|--privacy T FILE")
+	fmt.Println("    T:     Fewer than T horcrux-files reveal nothing, each is about 1/(M-T+1) of FILE [1..M]")
+	fmt.Println("- Split without key (Shamir):  " + self + " [-z|--zstd] [-n|--number N] [-m|--minimum M] -D|--direct FILE")
+	fmt.Println("    FILE:  Small file (up to 64 KiB) to share directly, each horcrux-file is as large as FILE")
+	fmt.Println("- Split along a policy:  " + self + " [-z|--zstd] -p|--policy POLICY FILE")
+	fmt.Println("    POLICY: Nested thresholds over holders, one horcrux-file per holder, like:")
+	fmt.Println("            'and(eng=2(alice,bob,carol),legal=or(dave,erin))' (M(...) needs M items)")
+	fmt.Println("    FILE:  Original file to split up and encrypt (several files give one set for all of them)")
+	fmt.Println("           A directory gets packed in a tar archive (zstd-compressed with -z), this needs N or M")
+	fmt.Println("           '-' reads the file from standard input, this needs -N|--name NAME")
+	fmt.Println("    NAME:  Filename to store [default: the name of FILE]")
+	fmt.Println("  -X/--xattrs, -U/--owner:  Also record extended attributes, owner and group (besides permissions and mtime)")
+	fmt.Println("  -o/--outdir OUTDIR:  Directory to write the horcrux-files in [default: current, for -r/-k: DIR]")
+	fmt.Println("  -M/--mode MODE:  Permissions of the horcrux-files (also for -r/-k) or reconstructed files [default: 600]")
+	fmt.Println("  -T/--template TEMPLATE:  Names of the horcrux-files, with {name}, {holder}, {index}, {total}, {set}, {ext}")
+	fmt.Println("           like '{index}/{name}-{holder}-{index}of{total}.{ext}' (a directory for each)")
+	fmt.Println("- Reconstruct file:  " + self + " [-z|--zstd] [-x|--extract NAME] [-C|--directory DEST | -O|--output PATH | -c|--stdout] [--overwrite|--no-clobber|--suffix] [-M|--mode MODE | -P|--preserve] [DIR]")
 	fmt.Println("   DIR:  Directory with horcrux-files to reconstruct [default: current]")
+	fmt.Println("   DEST: Directory to reconstruct the file or directory in [default: current]")
+	fmt.Println("   -c/--stdout: Write the file (or the archive of a directory) to standard output")
+	fmt.Println("   -O/--output PATH: Write the file (or directory) to PATH instead")
+	fmt.Println("   -P/--preserve: Restore the recorded permissions, mtime, extended attributes and owner of the file")
+	fmt.Println("                  [default permissions: 600, or -M MODE]")
+	fmt.Println("   --overwrite | --no-clobber | --suffix: Replace, keep, or write next to (with a numbered")
+	fmt.Println("                suffix) an existing file [default: ask for a new name, only on a terminal]")
+	fmt.Println("   NAME: Only reconstruct this one of the files protected by the horcrux-files")
+	fmt.Println("- Run command with file:  " + self + " [-z|--zstd] [-x|--extract NAME] -e|--exec [-E|--env VAR | -F|--fd] [DIR] -- COMMAND...")
+	fmt.Println("   COMMAND: Gets the file (reconstructed in memory only) on standard input [default],")
+	fmt.Println("            in environment variable VAR, or with -F as an anonymous file: the path")
+	fmt.Println("            replaces argument '{}' or else is in HORCRUX_FILE (not on windows)")
+	fmt.Println("- Recovery drill:  " + self + " [-z|--zstd] -d|--drill [DIR]")
+	fmt.Println("   DIR:  Check that every combination of the minimum number of horcrux-files here reconstructs")
+	fmt.Println("- Issue horcrux-file:  " + self + " [-f|--force] [-z|--zstd] -i|--issue INDEX [DIR]")
+	fmt.Println("   INDEX:  Index of a lost horcrux-file to replace, or above the total for an additional one")
+	fmt.Println("   DIR:    Directory with the minimum number of horcrux-files [default: current]")
+	fmt.Println("- Reshare:  " + self + " [-f|--force] [-z|--zstd] -r|--reshare [-n N] [-m M] [-w W,...|-p POLICY] [DIR]")
+	fmt.Println("- Rekey:  " + self + " [-f|--force] [-z|--zstd] -k|--rekey [-n N] [-m M] [-w W,...|-p POLICY] [DIR]")
+	fmt.Println("   N, M, W, POLICY:  New number/minimum/weights/policy [default: unchanged, M: N when only N given]")
+	fmt.Println("   DIR:   Directory with the minimum number of horcrux-files [default: current]")
+	fmt.Println("- Refresh horcrux-files (each holder in turn, without reconstructing the key):")
+	fmt.Println("   1. Make sub-updates:  " + self + " [-f|--force] -u|--update FILE")
+	fmt.Println("   2. Apply sub-updates:  " + self + " -a|--apply FILE")
+	fmt.Println("   FILE:  Horcrux-file of the holder, sub-update files are in the same directory")
+	fmt.Println("- Sub-share horcrux-file:  " + self + " [-f|--force] -s|--subshare [-n|--number N] [-m|--minimum M] FILE")
+	fmt.Println("   N, M:  Number of delegates and minimum needed to stand in for FILE [default: 2, N]")
+	fmt.Println("   FILE:  Horcrux-file to split among delegates (merging uses enough of them in its place)")
 	fmt.Println("- Query horcrux-file:  " + self + " -q|--query FILE")
 	fmt.Println("   FILE:  Horcrux-file to query for information (.yml files can be viewed too)")
 	fmt.Println("- Get help or version:  " + self + " -h|--help | -V|--version")
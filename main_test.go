@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMainProcess runs main with the arguments after "--" when started by horcrux
+func TestMainProcess(t *testing.T) {
+	if os.Getenv("HORCRUX_TEST_MAIN") != "1" {
+		t.Skip("only run by horcrux")
+	}
+
+	for i, arg := range os.Args {
+		if arg == "--" {
+			os.Args = append([]string{"horcrux"}, os.Args[i+1:]...)
+			break
+		}
+	}
+	main()
+	os.Exit(0)
+}
+
+// horcrux runs the command line with args in dir and returns its output and exit code
+func horcrux(t *testing.T, dir string, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], append([]string{"-test.run=^TestMainProcess$", "--"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "HORCRUX_TEST_MAIN=1")
+	out, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return string(out), exitErr.ExitCode()
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(out), 0
+}
+
+func TestDirectSeveralFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, flag := range []string{"-D", "--direct", "-t"} {
+		args := []string{flag, "-n", "3", "-m", "2", "a", "b"}
+		if flag == "-t" {
+			args = []string{flag, "1", "-n", "3", "-m", "2", "a", "b"}
+		}
+		out, code := horcrux(t, dir, args...)
+		if code == 0 || !strings.Contains(out, "can only be used on a single file") {
+			t.Errorf("horcrux %s: exit code %d, output:\n%s", strings.Join(args, " "), code, out)
+		}
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yml"))
+	if err != nil || len(paths) != 0 {
+		t.Errorf("horcrux-files written: %v %v", paths, err)
+	}
+}
+
+func TestModePreserve(t *testing.T) {
+	dir := t.TempDir()
+	out, code := horcrux(t, dir, "-M", "640", "-P", ".")
+	if code == 0 || !strings.Contains(out, "can't be used together") {
+		t.Errorf("horcrux -M 640 -P: exit code %d, output:\n%s", code, out)
+	}
+}
@@ -0,0 +1,257 @@
+package commands
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Kinds of archive a directory gets packed in
+const (
+	archiveTar     = "tar"
+	archiveTarZstd = "tar.zst"
+)
+
+// archiveReader returns a reader that streams the directory at dir as a tar archive
+// (compressed with zstd when compress), keeping modes, mtimes and symlinks
+func archiveReader(dir string, compress bool) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(writeArchive(dir, compress, writer))
+	}()
+	return reader
+}
+
+// writeArchive writes the directory at dir as a tar archive to writer
+func writeArchive(dir string, compress bool, writer io.Writer) error {
+	var zwriter *zstd.Encoder
+	if compress {
+		var err error
+		zwriter, err = zstd.NewWriter(writer)
+		if err != nil {
+			return err
+		}
+
+		writer = zwriter
+	}
+	tarwriter := tar.NewWriter(writer)
+	err := filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			link, err = os.Readlink(name)
+			if err != nil {
+				return err
+			}
+		} else if !info.Mode().IsRegular() && !info.IsDir() {
+			fmt.Printf("Skipping '%s', only files, directories and symlinks are archived\n", name)
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+
+		header.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+		err = tarwriter.WriteHeader(header)
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+		_, err = io.Copy(tarwriter, file)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tarwriter.Close()
+	if err != nil || zwriter == nil {
+		return err
+	}
+
+	return zwriter.Close()
+}
+
+// restoreArchive restores the directory target from the archive of the given kind
+// written by write (an existing target is handled according to collision),
+// with the archived permissions masked by mask,
+// it is only put in place when it is completely restored
+func restoreArchive(target, kind, collision string, mask os.FileMode, write func(io.Writer) error) error {
+	target, err := freePath(target, collision)
+	if err != nil || target == "" {
+		return err
+	}
+
+	// The directory is restored next to target, and only put in place when complete
+	temp, err := os.MkdirTemp(filepath.Dir(target), "."+filepath.Base(target)+".*.tmp")
+	if err != nil {
+		return errors.New("problem creating directory " + target)
+	}
+
+	pending.track(temp)
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(write(writer))
+	}()
+	err = extractArchive(reader, kind, temp, mask)
+	if err == nil {
+		// Read up to the end, so the digest gets checked
+		_, err = io.Copy(io.Discard, reader)
+	}
+	if err != nil {
+		reader.CloseWithError(err)
+		pending.discard(temp)
+		return errors.New(err.Error() + " (nothing written)")
+	}
+
+	err = commit([]string{temp}, []string{target})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Restored: ", target)
+	return nil
+}
+
+// extractArchive extracts the archive of the given kind from reader into the
+// directory target with the archived permissions masked by mask,
+// no entry can end up outside of it
+func extractArchive(reader io.Reader, kind, target string, mask os.FileMode) error {
+	if kind == archiveTarZstd {
+		zreader, err := zstd.NewReader(reader)
+		if err != nil {
+			return err
+		}
+
+		defer zreader.Close()
+		reader = zreader
+	} else if kind != archiveTar {
+		return fmt.Errorf("unknown archive '%s'", kind)
+	}
+
+	root, err := os.OpenRoot(target)
+	if err != nil {
+		return err
+	}
+
+	defer root.Close()
+	var dirs []*tar.Header
+	tarreader := tar.NewReader(reader)
+	for {
+		header, err := tarreader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean(header.Name)
+		if !filepath.IsLocal(name) && name != "." || strings.Contains(name, `\`) {
+			return fmt.Errorf("unsafe path '%s' in the archive", header.Name)
+		}
+
+		if dir := path.Dir(name); dir != "." {
+			err = root.MkdirAll(dir, 0700)
+			if err != nil {
+				return err
+			}
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if name != "." {
+				err = root.Mkdir(name, 0700)
+				if errors.Is(err, fs.ErrExist) {
+					err = nil
+				}
+			}
+			header.Name = name
+			dirs = append(dirs, header)
+		case tar.TypeReg:
+			err = extractFile(root, name, header, mask, tarreader)
+		case tar.TypeSymlink:
+			err = root.Symlink(header.Linkname, name)
+		default:
+			fmt.Printf("Skipping '%s' in the archive, only files, directories and symlinks are restored\n", header.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Directories last, deepest first, as adding entries changes their mtime
+	// and their mode could forbid adding entries
+	slices.Reverse(dirs)
+	for _, header := range dirs {
+		err = root.Chmod(header.Name, header.FileInfo().Mode().Perm()&mask)
+		if err == nil {
+			err = root.Chtimes(header.Name, header.ModTime, header.ModTime)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractFile writes file name in root from reader, with the mtime of header
+// and its permissions masked by mask
+func extractFile(root *os.Root, name string, header *tar.Header, mask os.FileMode, reader io.Reader) error {
+	file, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, reader)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	err = root.Chmod(name, header.FileInfo().Mode().Perm()&mask)
+	if err != nil {
+		return err
+	}
+
+	return root.Chtimes(name, header.ModTime, header.ModTime)
+}
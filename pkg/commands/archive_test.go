@@ -0,0 +1,189 @@
+package commands
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// tarEntry is an entry of a crafted tar archive
+type tarEntry struct {
+	name, link string
+	kind       byte
+	content    string
+}
+
+// craftTar returns a tar archive with entries
+func craftTar(t *testing.T, entries []tarEntry) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Linkname: e.link, Typeflag: e.kind, Mode: 0644, Size: int64(len(e.content))}
+		if e.kind != tar.TypeReg {
+			header.Size = 0
+		}
+		if e.kind == tar.TypeDir {
+			header.Mode = 0755
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+
+		if e.kind == tar.TypeReg {
+			tw.Write([]byte(e.content))
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf
+}
+
+func TestExtractArchiveUnsafe(t *testing.T) {
+	// The restored directory and the one outside of it are next to each other
+	parent := t.TempDir()
+	outside := filepath.Join(parent, "outside")
+	os.Mkdir(outside, 0700)
+	tests := []struct {
+		name    string
+		entries []tarEntry
+	}{
+		{"parent", []tarEntry{{name: "../x", kind: tar.TypeReg, content: "x"}}},
+		{"nested parent", []tarEntry{{name: "a/../../x", kind: tar.TypeReg, content: "x"}}},
+		{"absolute", []tarEntry{{name: filepath.Join(outside, "x"), kind: tar.TypeReg, content: "x"}}},
+		{"symlink to outside", []tarEntry{
+			{name: "link", link: outside, kind: tar.TypeSymlink},
+			{name: "link/x", kind: tar.TypeReg, content: "x"},
+		}},
+		{"relative symlink to outside", []tarEntry{
+			{name: "link", link: "../outside", kind: tar.TypeSymlink},
+			{name: "link/x", kind: tar.TypeReg, content: "x"},
+		}},
+		{"symlinked directory to outside", []tarEntry{
+			{name: "link", link: outside, kind: tar.TypeSymlink},
+			{name: "link/sub/", kind: tar.TypeDir},
+		}},
+		{"backslash", []tarEntry{{name: `..\x`, kind: tar.TypeReg, content: "x"}}},
+		{"duplicate file", []tarEntry{
+			{name: "x", kind: tar.TypeReg, content: "first"},
+			{name: "x", kind: tar.TypeReg, content: "second"},
+		}},
+		{"file over symlink", []tarEntry{
+			{name: "x", link: filepath.Join(outside, "x"), kind: tar.TypeSymlink},
+			{name: "x", kind: tar.TypeReg, content: "x"},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := filepath.Join(parent, "restored")
+			os.Mkdir(target, 0700)
+			defer os.RemoveAll(target)
+			err := extractArchive(craftTar(t, test.entries), archiveTar, target, 0777)
+			if err == nil {
+				t.Fatal("unsafe archive extracted")
+			}
+
+			if names := dirNames(t, outside); len(names) > 0 {
+				t.Fatalf("written outside of the directory: %v", names)
+			}
+		})
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	for _, kind := range []string{archiveTar, archiveTarZstd} {
+		t.Run(kind, func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), "src")
+			mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+			os.MkdirAll(filepath.Join(src, "sub"), 0750)
+			os.WriteFile(filepath.Join(src, "sub", "file"), []byte("content"), 0640)
+			os.WriteFile(filepath.Join(src, "exec"), []byte("#!/bin/sh\n"), 0750)
+			os.Symlink("sub/file", filepath.Join(src, "link"))
+			for _, name := range []string{"sub/file", "exec", "sub", "."} {
+				os.Chtimes(filepath.Join(src, name), mtime, mtime)
+			}
+			os.Chmod(src, 0710)
+
+			archive := &bytes.Buffer{}
+			if err := writeArchive(src, kind == archiveTarZstd, archive); err != nil {
+				t.Fatal(err)
+			}
+
+			target := filepath.Join(t.TempDir(), "restored")
+			os.Mkdir(target, 0700)
+			if err := extractArchive(archive, kind, target, 0777); err != nil {
+				t.Fatal(err)
+			}
+
+			for name, mode := range map[string]os.FileMode{".": 0710, "sub": 0750, "sub/file": 0640, "exec": 0750} {
+				info, err := os.Stat(filepath.Join(target, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if info.Mode().Perm() != mode {
+					t.Errorf("%s has mode %o, want %o", name, info.Mode().Perm(), mode)
+				}
+				if !info.ModTime().Equal(mtime) {
+					t.Errorf("%s has mtime %v, want %v", name, info.ModTime(), mtime)
+				}
+			}
+			checkFile(t, filepath.Join(target, "sub", "file"), "content")
+			link, err := os.Readlink(filepath.Join(target, "link"))
+			if err != nil || link != "sub/file" {
+				t.Fatalf("link points to %q (%v), want sub/file", link, err)
+			}
+		})
+	}
+}
+
+func TestArchiveMask(t *testing.T) {
+	tests := []struct {
+		perm     os.FileMode
+		preserve bool
+		want     os.FileMode
+	}{
+		{0, false, 0700},
+		{0600, false, 0700},
+		{0640, false, 0750},
+		{0644, false, 0755},
+		{0200, false, 0200},
+		{0600, true, 0777},
+	}
+	for _, test := range tests {
+		if got := archiveMask(test.perm, test.preserve); got != test.want {
+			t.Errorf("archiveMask(%o, %v) = %o, want %o", test.perm, test.preserve, got, test.want)
+		}
+	}
+
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "sub"), 0755)
+	os.WriteFile(filepath.Join(src, "sub", "file"), []byte("content"), 0644)
+	os.WriteFile(filepath.Join(src, "exec"), []byte("#!/bin/sh\n"), 0755)
+	archive := &bytes.Buffer{}
+	if err := writeArchive(src, false, archive); err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(t.TempDir(), "restored")
+	os.Mkdir(target, 0700)
+	if err := extractArchive(archive, archiveTar, target, archiveMask(0, false)); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, mode := range map[string]os.FileMode{"sub": 0700, "sub/file": 0600, "exec": 0700} {
+		info, err := os.Stat(filepath.Join(target, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode().Perm() != mode {
+			t.Errorf("%s has mode %o, want %o", name, info.Mode().Perm(), mode)
+		}
+	}
+}
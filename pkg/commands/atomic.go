@@ -0,0 +1,214 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// Files are written into a temporary file in the same directory first, that is
+// synced and then renamed into place, so an existing file is never left half
+// written. The temporary files are tracked, so they are removed again when the
+// program gets interrupted. Putting files in place (moving existing ones aside
+// first, and back when anything fails) is never interrupted halfway.
+
+// pendingFiles are the files that get removed on an interrupt
+type pendingFiles struct {
+	sync.Mutex
+	paths map[string]bool
+	once  sync.Once
+}
+
+var pending = &pendingFiles{paths: map[string]bool{}}
+
+// track adds path to the pending files
+func (p *pendingFiles) track(path string) {
+	p.once.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			p.Lock()
+			for path := range p.paths {
+				os.RemoveAll(path)
+			}
+			fmt.Println("Interrupted, unfinished output removed")
+			os.Exit(130)
+		}()
+	})
+	p.Lock()
+	defer p.Unlock()
+	p.paths[path] = true
+}
+
+// discard removes paths and takes them off the pending files
+func (p *pendingFiles) discard(paths ...string) {
+	p.Lock()
+	defer p.Unlock()
+	for _, path := range paths {
+		os.RemoveAll(path)
+		delete(p.paths, path)
+	}
+}
+
+// stage writes the content for path with write into a pending temporary file
+// with permissions perm, and returns its name once it is synced to disk
+func stage(path string, perm os.FileMode, write func(io.Writer) error) (string, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("problem writing to %s", path)
+	}
+
+	pending.track(file.Name())
+	err = file.Chmod(perm)
+	if err == nil {
+		err = write(file)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		pending.discard(file.Name())
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+// commit renames the staged temporary files temps to paths, all or nothing:
+// existing files are moved aside first, when a rename fails the new files are
+// taken away again and the existing ones put back (an interrupt waits until
+// the commit is done or rolled back)
+func commit(temps, paths []string) error {
+	pending.Lock()
+	defer pending.Unlock()
+	backups := make([]string, len(paths))
+	for i := range temps {
+		var err error
+		backups[i], err = moveAside(paths[i], temps[i])
+		if err == nil && os.Rename(temps[i], paths[i]) != nil {
+			err = fmt.Errorf("problem writing to %s", paths[i])
+		}
+		if err != nil {
+			rollback(paths, backups, i)
+			for _, temp := range temps[i:] {
+				os.RemoveAll(temp)
+				delete(pending.paths, temp)
+			}
+			return errors.New(err.Error() + ", nothing written")
+		}
+
+		delete(pending.paths, temps[i])
+	}
+
+	// Make the renames durable, only then the old files can go
+	synced := map[string]bool{}
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if !synced[dir] {
+			syncDir(dir)
+			synced[dir] = true
+		}
+	}
+	for _, backup := range backups {
+		if info, err := os.Lstat(backup); err == nil && info.IsDir() {
+			os.RemoveAll(backup)
+		} else if backup != "" {
+			os.Remove(backup)
+		}
+	}
+	return nil
+}
+
+// moveAside renames an existing file (or directory) at path to a free name
+// next to it and returns that ("" when there is nothing at path), only a file
+// replaces a file and only a directory (an extracted archive) a directory
+func moveAside(path, temp string) (string, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return "", nil
+	}
+
+	staged, err := os.Lstat(temp)
+	if err != nil {
+		return "", fmt.Errorf("problem writing to %s", path)
+	}
+
+	if info.IsDir() && !staged.IsDir() {
+		return "", fmt.Errorf("'%s' is a directory, it can't be replaced by a file", path)
+	}
+
+	if !info.IsDir() && staged.IsDir() {
+		return "", fmt.Errorf("'%s' is not a directory, it can't be replaced by one", path)
+	}
+
+	for {
+		random, err := newSet()
+		if err != nil {
+			return "", err
+		}
+
+		backup := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+"."+random+".old")
+		if _, err := os.Lstat(backup); err == nil {
+			continue
+		}
+
+		err = os.Rename(path, backup)
+		if err != nil {
+			return "", fmt.Errorf("problem writing to %s", path)
+		}
+
+		return backup, nil
+	}
+}
+
+// rollback takes away the files put in place at the first done paths,
+// and puts back the existing files that were moved aside to backups
+func rollback(paths, backups []string, done int) {
+	for i, backup := range backups {
+		if i < done {
+			if backup == "" {
+				os.RemoveAll(paths[i])
+				continue
+			}
+
+			// A directory can't be renamed over
+			if info, err := os.Lstat(paths[i]); err == nil && info.IsDir() {
+				os.RemoveAll(paths[i])
+			}
+		}
+		if backup != "" {
+			os.Rename(backup, paths[i])
+		}
+	}
+}
+
+// syncDir syncs directory dir to disk, where the system supports it
+func syncDir(dir string) {
+	file, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+
+	file.Sync()
+	file.Close()
+}
+
+// writeAtomic writes path with write and permissions perm, replacing an existing
+// file only when everything is written
+func writeAtomic(path string, perm os.FileMode, write func(io.Writer) error) error {
+	temp, err := stage(path, perm, write)
+	if err != nil {
+		return err
+	}
+
+	return commit([]string{temp}, []string{path})
+}
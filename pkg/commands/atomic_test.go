@@ -0,0 +1,143 @@
+package commands
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// stageString stages content for path
+func stageString(t *testing.T, path, content string) string {
+	t.Helper()
+	temp, err := stage(path, 0600, func(writer io.Writer) error {
+		_, err := io.WriteString(writer, content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return temp
+}
+
+func TestCommit(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	os.WriteFile(a, []byte("old a"), 0600)
+	temps := []string{stageString(t, a, "new a"), stageString(t, b, "new b")}
+	err := commit(temps, []string{a, b})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkFile(t, a, "new a")
+	checkFile(t, b, "new b")
+	if names := dirNames(t, dir); !slices.Equal(names, []string{"a", "b"}) {
+		t.Fatalf("left behind: %v", names)
+	}
+	if len(pending.paths) != 0 {
+		t.Fatalf("still pending: %v", pending.paths)
+	}
+}
+
+func TestCommitRollback(t *testing.T) {
+	dir := t.TempDir()
+	a, b, c := filepath.Join(dir, "a"), filepath.Join(dir, "b"), filepath.Join(dir, "c")
+	os.WriteFile(a, []byte("old a"), 0600)
+	os.WriteFile(c, []byte("old c"), 0600)
+	temps := []string{stageString(t, a, "new a"), stageString(t, b, "new b"), stageString(t, c, "new c")}
+
+	// The third file can't be put in place, its directory is gone
+	missing := filepath.Join(dir, "missing", "c")
+	err := commit(temps, []string{a, b, missing})
+	if err == nil {
+		t.Fatal("commit into a missing directory succeeded")
+	}
+
+	checkFile(t, a, "old a")
+	checkFile(t, c, "old c")
+	if names := dirNames(t, dir); !slices.Equal(names, []string{"a", "c"}) {
+		t.Fatalf("not rolled back: %v", names)
+	}
+	if len(pending.paths) != 0 {
+		t.Fatalf("still pending: %v", pending.paths)
+	}
+}
+
+func TestCommitRollbackDirectory(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "d")
+	os.Mkdir(target, 0700)
+	os.WriteFile(filepath.Join(target, "f"), []byte("old"), 0600)
+	temp, err := os.MkdirTemp(dir, ".d.*.tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending.track(temp)
+	os.WriteFile(filepath.Join(temp, "f"), []byte("new"), 0600)
+	other := stageString(t, filepath.Join(dir, "x"), "x")
+	err = commit([]string{temp, other}, []string{target, filepath.Join(dir, "missing", "x")})
+	if err == nil {
+		t.Fatal("commit into a missing directory succeeded")
+	}
+
+	checkFile(t, filepath.Join(target, "f"), "old")
+	if names := dirNames(t, dir); !slices.Equal(names, []string{"d"}) {
+		t.Fatalf("not rolled back: %v", names)
+	}
+}
+
+func TestCommitKind(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "d")
+	os.Mkdir(target, 0700)
+	os.WriteFile(filepath.Join(target, "keep"), []byte("important"), 0600)
+	err := commit([]string{stageString(t, target, "a file")}, []string{target})
+	if err == nil {
+		t.Fatal("a file replaced a directory")
+	}
+
+	checkFile(t, filepath.Join(target, "keep"), "important")
+	if names := dirNames(t, dir); !slices.Equal(names, []string{"d"}) {
+		t.Fatalf("left behind: %v", names)
+	}
+
+	file := filepath.Join(dir, "f")
+	os.WriteFile(file, []byte("old"), 0600)
+	temp, err := os.MkdirTemp(dir, ".f.*.tmp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending.track(temp)
+	err = commit([]string{temp}, []string{file})
+	if err == nil {
+		t.Fatal("a directory replaced a file")
+	}
+
+	checkFile(t, file, "old")
+	if names := dirNames(t, dir); !slices.Equal(names, []string{"d", "f"}) {
+		t.Fatalf("left behind: %v", names)
+	}
+}
+
+func TestWriteAtomicDigest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f")
+	os.WriteFile(path, []byte("old"), 0600)
+	err := writeAtomic(path, 0600, func(writer io.Writer) error {
+		io.WriteString(writer, "damaged")
+		return errDigest
+	})
+	if err != errDigest {
+		t.Fatalf("got %v, want errDigest", err)
+	}
+
+	checkFile(t, path, "old")
+	if names := dirNames(t, dir); !slices.Equal(names, []string{"f"}) {
+		t.Fatalf("left behind: %v", names)
+	}
+}
@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/pepa65/horcrux/pkg/shamir"
+)
+
+// ModeDirect shares the file itself with Shamir's secret sharing, without AES
+const ModeDirect = "direct"
+
+// directCap is the size above which direct mode gets impractical,
+// as every horcrux-file is as large as the file itself
+const directCap = 64 * 1024
+
+// directParts returns the n horcrux-files of yml that each carry
+// a Shamir share of data as payload (m needed to reconstruct)
+func directParts(yml ymlFile, data []byte, n int, m int) ([]ymlFile, error) {
+	if len(data) > directCap {
+		fmt.Printf("Warning: direct mode is meant for small secrets (up to %d KiB), every horcrux-file will be as large as the file (%d bytes)\n", directCap/1024, len(data))
+	}
+
+	shares, err := shamir.SplitBulk(seal(data), n, m)
+	if err != nil {
+		return nil, errors.New("error splitting the file")
+	}
+
+	yml.Total = n
+	yml.Minimum = m
+	parts := make([]ymlFile, n)
+	for i, share := range shares {
+		yml.Index = i + 1
+		yml.Payload = base64.StdEncoding.EncodeToString(share)
+		parts[i] = yml
+	}
+	return parts, nil
+}
+
+// combineDirect reconstructs the file from horcrux-files in direct mode
+func combineDirect(ymls []ymlFile) ([]byte, error) {
+	shares := make([][]byte, len(ymls))
+	for i, yml := range ymls {
+		var err error
+		shares[i], err = base64.StdEncoding.DecodeString(yml.Payload)
+		if err != nil {
+			return nil, errors.New("error decoding payload")
+		}
+	}
+	sealed, err := shamir.CombineBulk(shares)
+	if err != nil {
+		return nil, errors.New("problem recombining the shares")
+	}
+
+	data, err := unseal(sealed)
+	if err != nil {
+		clear(sealed)
+	}
+	return data, err
+}
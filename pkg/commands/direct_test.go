@@ -0,0 +1,63 @@
+package commands
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDirect(t *testing.T) {
+	content := strings.Repeat("shared directly\n", 100)
+	dir := splitString(t, content, 4, 3, ModeDirect)
+	paths := setFiles(t, dir, 4)
+	yml, err := readHorcrux(paths[0], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if yml.Mode != ModeDirect || yml.Keypart != "" || yml.Digest != "" {
+		t.Errorf("horcrux-file in direct mode: mode %q, keypart %q, digest %q", yml.Mode, yml.Keypart, yml.Digest)
+	}
+
+	err = os.Remove(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := mergeString(t, dir)
+	if err != nil || got != content {
+		t.Errorf("merge of 3 out of 4: got %d bytes (%v), want %d", len(got), err, len(content))
+	}
+
+	err = os.Remove(paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = mergeString(t, dir)
+	if err == nil || got != "" {
+		t.Errorf("merge of 2 out of 4 with minimum 3: got %q (%v)", got, err)
+	}
+}
+
+func TestDirectTampered(t *testing.T) {
+	dir := splitString(t, "tampered", 2, 2, ModeDirect)
+	path := setFiles(t, dir, 2)[0]
+	yml, err := readHorcrux(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte(yml.Payload)
+	payload[len(payload)/2] ^= 'A' ^ 'B'
+	yml.Payload = string(payload)
+	err = writeHorcrux(path, yml, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := mergeString(t, dir)
+	if err == nil || got != "" {
+		t.Errorf("merge of a tampered set: got %q (%v)", got, err)
+	}
+}
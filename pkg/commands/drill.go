@@ -0,0 +1,208 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+)
+
+// maxDrills is the maximum number of combinations that get checked,
+// beyond that a random sample of this size is taken
+const maxDrills = 1000
+
+// Drill checks that every combination of the minimum number of horcrux-files
+// in dir reconstructs the original file
+func Drill(dir string, compressed bool) error {
+	ymls, filenames, err := readHorcruxes(dir, compressed)
+	if err != nil {
+		return err
+	}
+
+	n, m := len(ymls), ymls[0].Minimum
+	if m < 1 {
+		m = 1
+	}
+	if ymls[0].Digest == "" && ymls[0].Mode == "" && ymls[0].Secrets == nil {
+		fmt.Println("Warning: these horcrux-files have no digest, only checking that they decrypt")
+	}
+	count := binomial(n, m)
+	var combos [][]int
+	if ymls[0].Weights != nil || ymls[0].Policy != "" {
+		enough, err := enoughFunc(ymls)
+		if err != nil {
+			return err
+		}
+
+		combos = qualified(n, enough)
+		if len(combos) > maxDrills {
+			fmt.Printf("Checking a random sample of %d out of %d smallest sufficient combinations\n", maxDrills, len(combos))
+			rand.Shuffle(len(combos), func(i, j int) { combos[i], combos[j] = combos[j], combos[i] })
+			combos = combos[:maxDrills]
+		} else {
+			fmt.Printf("Checking all %d smallest sufficient combinations out of %d horcrux-files\n", len(combos), n)
+		}
+	} else if count > maxDrills {
+		fmt.Printf("Checking a random sample of %d out of %d combinations of %d horcrux-files\n", maxDrills, count, m)
+		seen := map[string]bool{}
+		for len(combos) < maxDrills {
+			combo := rand.Perm(n)[:m]
+			slices.Sort(combo)
+			id := fmt.Sprint(combo)
+			if !seen[id] {
+				seen[id] = true
+				combos = append(combos, combo)
+			}
+		}
+	} else {
+		fmt.Printf("Checking all %d combinations of %d out of %d horcrux-files\n", count, m, n)
+		combos = combinations(n, m)
+	}
+	failed := 0
+	for _, combo := range combos {
+		subset := make([]ymlFile, len(combo))
+		names := make([]string, len(combo))
+		for i, j := range combo {
+			subset[i] = ymls[j]
+			names[i] = fmt.Sprintf("%s (index %d)", filenames[j], ymls[j].Index)
+		}
+		write, wipe, err := reconstruct(subset)
+		if err == nil {
+			err = write(io.Discard)
+			wipe()
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("FAILED: %s: %v\n", strings.Join(names, ", "), err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d combinations failed to reconstruct", failed, len(combos))
+	}
+
+	if ymls[0].Secrets != nil {
+		fmt.Printf("All %d combinations reconstruct all %d files\n", len(combos), len(ymls[0].Secrets))
+		return nil
+	}
+
+	fmt.Printf("All %d combinations reconstruct '%s'\n", len(combos), ymls[0].Filename)
+	return nil
+}
+
+// enoughFunc returns a function that tells whether a combination of
+// weighted or policy horcrux-files is sufficient to reconstruct
+func enoughFunc(ymls []ymlFile) (func([]int) bool, error) {
+	if ymls[0].Policy != "" {
+		node, err := parsePolicy(ymls[0].Policy)
+		if err != nil {
+			return nil, err
+		}
+
+		return func(combo []int) bool {
+			names := map[string]bool{}
+			for _, j := range combo {
+				names[ymls[j].Holder] = true
+			}
+			return node.satisfied(names)
+		}, nil
+	}
+
+	return func(combo []int) bool {
+		points := 0
+		for _, j := range combo {
+			points += ymls[j].weight()
+		}
+		return points >= ymls[0].Minimum
+	}, nil
+}
+
+// qualified returns the combinations of n horcrux-files that are enough,
+// but not anymore without any one of them
+// (beyond 20 horcrux-files a random sample of sufficient combinations)
+func qualified(n int, enough func([]int) bool) [][]int {
+	var combos [][]int
+	if n > 20 {
+		seen := map[string]bool{}
+		for tries := 0; tries < 10*maxDrills && len(combos) < maxDrills; tries++ {
+			combo := []int{}
+			for _, j := range rand.Perm(n) {
+				if enough(combo) {
+					break
+				}
+
+				combo = append(combo, j)
+			}
+			slices.Sort(combo)
+			id := fmt.Sprint(combo)
+			if enough(combo) && !seen[id] {
+				seen[id] = true
+				combos = append(combos, combo)
+			}
+		}
+		return combos
+	}
+
+	for mask := 1; mask < 1<<n; mask++ {
+		combo := []int{}
+		for j := 0; j < n; j++ {
+			if mask&(1<<j) != 0 {
+				combo = append(combo, j)
+			}
+		}
+		if !enough(combo) {
+			continue
+		}
+
+		smallest := true
+		for i := range combo {
+			if enough(slices.Delete(slices.Clone(combo), i, i+1)) {
+				smallest = false
+				break
+			}
+		}
+		if smallest {
+			combos = append(combos, combo)
+		}
+	}
+	return combos
+}
+
+// binomial returns the number of combinations of m out of n, capped at
+// math.MaxInt32 so it fits an int everywhere (n is at most 65535, so the
+// intermediate products fit a uint64)
+func binomial(n, m int) int {
+	var count uint64 = 1
+	for i := 1; i <= m; i++ {
+		count = count * uint64(n-m+i) / uint64(i)
+		if count > math.MaxInt32 {
+			return math.MaxInt32
+		}
+	}
+	return int(count)
+}
+
+// combinations returns all ordered combinations of m out of the indexes 0..n-1
+func combinations(n, m int) [][]int {
+	var combos [][]int
+	combo := make([]int, m)
+	for i := range combo {
+		combo[i] = i
+	}
+	for {
+		combos = append(combos, append([]int(nil), combo...))
+		i := m - 1
+		for i >= 0 && combo[i] == n-m+i {
+			i--
+		}
+		if i < 0 {
+			return combos
+		}
+
+		combo[i]++
+		for j := i + 1; j < m; j++ {
+			combo[j] = combo[j-1] + 1
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestDrill(t *testing.T) {
+	dir := splitString(t, "drilled", 4, 2, "")
+	err := Drill(dir, false)
+	if err != nil {
+		t.Fatalf("Drill of a sound set: %v", err)
+	}
+
+	// A damaged keypart only fails the combinations it is in
+	editHorcrux(t, filepath.Join(dir, "secret.txt_horcrux3of4.yml"), func(yml *ymlFile) {
+		keypart, err := hex.DecodeString(yml.Keypart)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keypart[0] ^= 1
+		yml.Keypart = hex.EncodeToString(keypart)
+	})
+	err = Drill(dir, false)
+	if err == nil || err.Error() != "3 of 6 combinations failed to reconstruct" {
+		t.Errorf("Drill of a damaged set returned %v", err)
+	}
+}
+
+func TestBinomial(t *testing.T) {
+	tests := []struct{ n, m, want int }{
+		{4, 2, 6},
+		{10, 4, 210},
+		{33, 16, 1166803110},
+		{34, 17, math.MaxInt32},
+		{60, 30, math.MaxInt32},
+		{65535, 32768, math.MaxInt32},
+	}
+	for _, test := range tests {
+		if got := binomial(test.n, test.m); got != test.want {
+			t.Errorf("binomial(%d, %d) = %d, want %d", test.n, test.m, got, test.want)
+		}
+	}
+}
+
+func TestCombinations(t *testing.T) {
+	for _, nm := range [][2]int{{1, 1}, {4, 2}, {5, 3}, {6, 6}, {10, 4}} {
+		n, m := nm[0], nm[1]
+		combos := combinations(n, m)
+		if len(combos) != binomial(n, m) {
+			t.Errorf("%d combinations of %d out of %d, want %d", len(combos), m, n, binomial(n, m))
+		}
+
+		seen := map[string]bool{}
+		for _, combo := range combos {
+			id := fmt.Sprint(combo)
+			if len(combo) != m || seen[id] {
+				t.Fatalf("bad or repeated combination %v of %d out of %d", combo, m, n)
+			}
+
+			seen[id] = true
+		}
+	}
+}
+
+func TestQualified(t *testing.T) {
+	// Weights 2,1,1 with minimum 3: the first with any other one
+	weights := []int{2, 1, 1}
+	enough := func(combo []int) bool {
+		points := 0
+		for _, j := range combo {
+			points += weights[j]
+		}
+		return points >= 3
+	}
+	got := fmt.Sprint(qualified(len(weights), enough))
+	if got != "[[0 1] [0 2]]" {
+		t.Errorf("qualified combinations: %s, want [[0 1] [0 2]]", got)
+	}
+}
+
+func TestDrillPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret.txt")
+	writeString(t, path, "drilled along a policy")
+	parts := t.TempDir()
+	err := Split(path, "", 0, 0, nil, "or(alice,2(bob,carol))", "", 0, Capture{}, Output{Dir: parts})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Drill(parts, false)
+	if err != nil {
+		t.Errorf("Drill of a policy set: %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// secretBuffer collects a reconstructed secret in memory,
+// wiping what it leaves behind when it grows
+type secretBuffer struct {
+	data []byte
+}
+
+func (b *secretBuffer) Write(p []byte) (int, error) {
+	if len(b.data)+len(p) > cap(b.data) {
+		grown := make([]byte, len(b.data), 2*cap(b.data)+len(p))
+		copy(grown, b.data)
+		clear(b.data)
+		b.data = grown
+	}
+	b.data = append(b.data, p...)
+	return len(p), nil
+}
+
+// wipe overwrites the secret with zeroes
+func (b *secretBuffer) wipe() {
+	clear(b.data[:cap(b.data)])
+}
+
+// Exec reconstructs the file from the horcrux-files in dir (the selected one of
+// a multi-secret set) in memory and runs command with it: on its standard input,
+// in environment variable envname, or with fd as an anonymous file at /dev/fd/3
+// (given instead of the argument "{}" or else in HORCRUX_FILE), a file in memory
+// on linux and a pipe elsewhere. The command writes to stdout, the secret is wiped
+// from memory when it has exited, except for the copies in the environment.
+func Exec(dir string, compressed bool, selected string, envname string, fd bool, command []string, stdout io.Writer) error {
+	ymls, _, err := readHorcruxes(dir, compressed)
+	if err != nil {
+		return err
+	}
+
+	secret, err := mergeSecret(ymls, selected)
+	if err != nil {
+		return errors.New(err.Error() + ", not running the command")
+	}
+
+	defer secret.wipe()
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, stdout, os.Stderr
+	switch {
+	case envname != "":
+		if bytes.IndexByte(secret.data, 0) >= 0 {
+			return errors.New("the file contains zero bytes, it can't be passed in an environment variable")
+		}
+
+		// The environment is handed over as strings, these copies can't be wiped
+		cmd.Env = append(os.Environ(), envname+"="+string(secret.data))
+	case fd:
+		if runtime.GOOS == "windows" {
+			return errors.New("passing an anonymous file is not supported on windows")
+		}
+
+		passFile(cmd)
+		file, err := memoryFile(secret.data)
+		if err == nil {
+			defer wipeFile(file, len(secret.data))
+			cmd.ExtraFiles = []*os.File{file}
+			break
+		}
+
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+
+		defer reader.Close()
+		cmd.ExtraFiles = []*os.File{reader}
+		err = cmd.Start()
+		if err != nil {
+			writer.Close()
+			return err
+		}
+
+		// The command reads the pipe as long as it likes, the rest is dropped when it exits
+		go func() {
+			writer.Write(secret.data)
+			writer.Close()
+		}()
+		return wait(cmd)
+	default:
+		cmd.Stdin = bytes.NewReader(secret.data)
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	return wait(cmd)
+}
+
+// passFile gives cmd the path of its first extra file, instead of
+// the argument "{}" or else in HORCRUX_FILE
+func passFile(cmd *exec.Cmd) {
+	path, passed := "/dev/fd/3", false
+	for i, arg := range cmd.Args {
+		if arg == "{}" {
+			cmd.Args[i], passed = path, true
+		}
+	}
+	if !passed {
+		cmd.Env = append(os.Environ(), "HORCRUX_FILE="+path)
+	}
+}
+
+// wipeFile overwrites the first size bytes of file with zeroes and closes it
+func wipeFile(file *os.File, size int) {
+	file.WriteAt(make([]byte, size), 0)
+	file.Close()
+}
+
+// wait waits for cmd to exit, an error is returned when it failed
+func wait(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr
+	}
+
+	if err != nil {
+		return errors.New("error running " + strings.Join(cmd.Args, " ") + ": " + err.Error())
+	}
+
+	return nil
+}
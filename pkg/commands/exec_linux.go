@@ -0,0 +1,27 @@
+package commands
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// memoryFile returns an anonymous file in memory holding data, positioned at its start
+func memoryFile(data []byte) (*os.File, error) {
+	fd, err := unix.MemfdCreate("horcrux", unix.MFD_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+
+	file := os.NewFile(uintptr(fd), "horcrux")
+	_, err = file.Write(data)
+	if err == nil {
+		_, err = file.Seek(0, 0)
+	}
+	if err != nil {
+		wipeFile(file, len(data))
+		return nil, err
+	}
+
+	return file, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package commands
+
+import (
+	"errors"
+	"os"
+)
+
+// memoryFile returns an anonymous file in memory holding data, positioned at its start
+func memoryFile(data []byte) (*os.File, error) {
+	return nil, errors.New("anonymous files in memory are not supported on this system")
+}
@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+
+	content := "the secret\nline two\n"
+	dir := splitString(t, content, 3, 2, "")
+	twice := content
+	if runtime.GOOS == "linux" {
+		// The file in memory can be opened again
+		twice += content
+	}
+	tests := []struct {
+		name    string
+		envname string
+		fd      bool
+		command []string
+		want    string
+	}{
+		{"stdin", "", false, []string{"sh", "-c", "cat"}, content},
+		{"env", "SECRET", false, []string{"sh", "-c", `printf %s "$SECRET"`}, content},
+		{"fd argument", "", true, []string{"sh", "-c", `cat "$1"`, "sh", "{}"}, content},
+		{"fd variable", "", true, []string{"sh", "-c", `cat "$HORCRUX_FILE"`}, content},
+		{"fd descriptor", "", true, []string{"sh", "-c", "cat <&3"}, content},
+		{"fd twice", "", true, []string{"sh", "-c", `cat "$HORCRUX_FILE" "$HORCRUX_FILE" 2>/dev/null`}, twice},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			err := Exec(dir, false, "", test.envname, test.fd, test.command, &stdout)
+			if err != nil {
+				t.Fatalf("Exec: %v", err)
+			}
+
+			if stdout.String() != test.want {
+				t.Errorf("command got %q, want %q", stdout.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestExecModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+
+	content := "shared without a key"
+	for _, mode := range []string{ModeRamp, ModeDirect} {
+		dir := splitString(t, content, 3, 2, mode)
+		var stdout bytes.Buffer
+		err := Exec(dir, false, "", "", false, []string{"cat"}, &stdout)
+		if err != nil || stdout.String() != content {
+			t.Errorf("%s: command got %q (%v), want %q", mode, stdout.String(), err, content)
+		}
+	}
+}
+
+func TestExecExitCode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+
+	dir := splitString(t, "secret", 2, 2, "")
+	err := Exec(dir, false, "", "", false, []string{"sh", "-c", "exit 3"}, &bytes.Buffer{})
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Fatalf("Exec returned %v, want exit status 3", err)
+	}
+}
+
+func TestExecTampered(t *testing.T) {
+	dir := splitString(t, "secret", 2, 2, "")
+	paths, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no horcrux-files: %v", err)
+	}
+
+	yml, err := readHorcrux(paths[0], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := []byte(yml.Payload)
+	payload[0] ^= 'A' ^ 'B'
+	yml.Payload = string(payload)
+	err = writeHorcrux(paths[0], yml, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ran := filepath.Join(t.TempDir(), "ran")
+	err = Exec(dir, false, "", "", false, []string{"touch", ran}, &bytes.Buffer{})
+	if err == nil {
+		t.Fatal("Exec ran the command with a tampered horcrux-file")
+	}
+
+	if fileExists(ran) {
+		t.Error("the command ran with a tampered horcrux-file")
+	}
+}
@@ -1,12 +1,153 @@
 package commands
 
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
 type ymlFile struct {
-	Filename  string `yaml:"filename"`
-	Timestamp int64  `yaml:"timestamp"`
-	Index     int    `yaml:"index"`
-	Total     int    `yaml:"total"`
-	Minimum   int    `yaml:"minimum"`
-	Keypart   string `yaml:"keypart"`
-	Payload   string `yaml:"payload"`
+	Filename   string            `yaml:"filename"`
+	Archive    string            `yaml:"archive,omitempty"`
+	Perm       string            `yaml:"perm,omitempty"`
+	Timestamp  int64             `yaml:"timestamp"`
+	Set        string            `yaml:"set,omitempty"`
+	Supersedes []string          `yaml:"supersedes,omitempty"`
+	Refresh    int               `yaml:"refresh,omitempty"`
+	Index      int               `yaml:"index"`
+	Total      int               `yaml:"total"`
+	Minimum    int               `yaml:"minimum"`
+	Field      int               `yaml:"field,omitempty"`
+	Mode       string            `yaml:"mode,omitempty"`
+	Privacy    int               `yaml:"privacy,omitempty"`
+	Weights    []int             `yaml:"weights,omitempty,flow"`
+	Policy     string            `yaml:"policy,omitempty"`
+	Holder     string            `yaml:"holder,omitempty"`
+	Coords     string            `yaml:"coords,omitempty"`
+	Digest     string            `yaml:"digest,omitempty"`
+	Meta       string            `yaml:"meta,omitempty"`
+	Keypart    string            `yaml:"keypart,omitempty"`
+	Keyparts   []string          `yaml:"keyparts,omitempty"`
+	Branches   map[string]string `yaml:"branches,omitempty"`
+	Sub        *subShare         `yaml:"sub,omitempty"`
+	Secrets    []secretFile      `yaml:"secrets,omitempty"`
+	Payload    string            `yaml:"payload"`
+}
+
+// subShare is the share of a delegate in the keyparts of a horcrux-file
+type subShare struct {
+	Set     string `yaml:"set"`
+	Index   int    `yaml:"index"`
+	Total   int    `yaml:"total"`
+	Minimum int    `yaml:"minimum"`
+	Keypart string `yaml:"keypart"`
+}
+
+// updateFile is a sub-update from one holder to another in a round of proactive refresh
+type updateFile struct {
+	Filename string `yaml:"filename"`
+	Set      string `yaml:"set"`
+	Refresh  int    `yaml:"refresh"`
+	From     int    `yaml:"from"`
+	To       int    `yaml:"to"`
+	Update   string `yaml:"update"`
+}
+
+// setID returns the identifier of the set the horcrux-file belongs to
+// (horcrux-files from before set identifiers are identified by their timestamp)
+func (yml ymlFile) setID() string {
+	if yml.Set != "" {
+		return yml.Set
+	}
+	return fmt.Sprint(yml.Timestamp)
+}
+
+// checkDigests returns an error when a digest is missing, only horcrux-files
+// from before digests (that have no set identifier either) and those that
+// share the file itself (sealed instead) come without
+func (yml ymlFile) checkDigests() error {
+	if yml.Mode != "" || yml.Set == "" {
+		return nil
+	}
+
+	if yml.Secrets == nil && yml.Digest == "" {
+		return errors.New("the digest is missing")
+	}
+
+	for _, secret := range yml.Secrets {
+		if secret.Digest == "" {
+			return errors.New("the digest of " + secret.Filename + " is missing")
+		}
+	}
+	return nil
+}
+
+// weight returns the number of keyparts (points) the horcrux-file carries:
+// in a weighted set the horcrux-file with index i carries the points i and on
+func (yml ymlFile) weight() int {
+	start := 1
+	for _, w := range yml.Weights {
+		if start == yml.Index {
+			return w
+		}
+		start += w
+	}
+	return 1
 }
 
+// keyed returns an error for horcrux-files that share the file itself instead of a key
+func (yml ymlFile) keyed() error {
+	if yml.Mode != "" {
+		return fmt.Errorf("horcrux-files in %s mode share the file itself and carry no keyparts", yml.Mode)
+	}
+	return nil
+}
+
+// chunked tells whether every horcrux-file carries a different part of the payload
+func (yml ymlFile) chunked() bool {
+	return yml.Total == yml.Minimum && yml.Weights == nil && yml.Mode == "" && yml.Secrets == nil
+}
+
+// digests returns the digests of the file(s) the horcrux-file protects
+func (yml ymlFile) digests() string {
+	digests := yml.Digest
+	for _, secret := range yml.Secrets {
+		digests += " " + secret.Filename + ":" + secret.Digest
+	}
+	return digests
+}
+
+// points returns the decoded keyparts of the horcrux-file
+func (yml ymlFile) points() ([][]byte, error) {
+	parts := yml.Keyparts
+	if yml.Keypart != "" {
+		parts = append([]string{yml.Keypart}, parts...)
+	}
+	if len(parts) != yml.weight() {
+		return nil, fmt.Errorf("horcrux-file %d should have %d keyparts", yml.Index, yml.weight())
+	}
+
+	points := make([][]byte, len(parts))
+	for i, part := range parts {
+		point, err := hex.DecodeString(part)
+		if err != nil || len(point) < 2 {
+			return nil, errors.New("bad keypart")
+		}
+
+		points[i] = point
+	}
+	return points, nil
+}
+
+// setPoints stores the keyparts in the horcrux-file
+func (yml *ymlFile) setPoints(points [][]byte) {
+	yml.Keypart, yml.Keyparts = "", nil
+	if len(points) == 1 {
+		yml.Keypart = hex.EncodeToString(points[0])
+		return
+	}
+
+	for _, point := range points {
+		yml.Keyparts = append(yml.Keyparts, hex.EncodeToString(point))
+	}
+}
@@ -0,0 +1,149 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// writeString writes a file holding content to path
+func writeString(t *testing.T, path, content string) {
+	t.Helper()
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// dirNames returns the names in dir
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+// checkFile fails when the file at path doesn't hold content
+func checkFile(t *testing.T, path, content string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != content {
+		t.Fatalf("%s holds %q, want %q", path, data, content)
+	}
+}
+
+// splitString splits a file holding content into n horcrux-files of which m
+// reconstruct it (in mode, with privacy m-1 for ramp), returns the directory they are in
+func splitString(t *testing.T, content string, n, m int, mode string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "secret.txt")
+	writeString(t, path, content)
+	privacy := 0
+	if mode == ModeRamp {
+		privacy = m - 1
+	}
+	parts := t.TempDir()
+	err := Split(path, "", n, m, nil, "", mode, privacy, Capture{}, Output{Dir: parts})
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+
+	return parts
+}
+
+// mergeString reconstructs the file from the horcrux-files in dir on standard output and returns it
+func mergeString(t *testing.T, dir string) (string, error) {
+	t.Helper()
+	var stdout bytes.Buffer
+	err := Merge(dir, false, "", Target{Stdout: &stdout})
+	return stdout.String(), err
+}
+
+// setFiles returns the horcrux-files in dir that belong to a set of total
+// (with or without the set identifier of a superseding set)
+func setFiles(t *testing.T, dir string, total int) []string {
+	t.Helper()
+	var paths []string
+	for _, pattern := range []string{"*of%d.yml", "*of%d_*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, fmt.Sprintf(pattern, total)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		paths = append(paths, matches...)
+	}
+	return paths
+}
+
+// keepOnly removes the horcrux-files from dir except those with the given name suffixes
+func keepOnly(t *testing.T, dir string, suffixes ...string) {
+	t.Helper()
+	for _, name := range dirNames(t, dir) {
+		keep := false
+		for _, suffix := range suffixes {
+			keep = keep || strings.HasSuffix(name, suffix)
+		}
+		if !keep {
+			err := os.Remove(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// editHorcruxes applies edit to all horcrux-files in dir
+func editHorcruxes(t *testing.T, dir string, edit func(yml *ymlFile)) {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		editHorcrux(t, path, edit)
+	}
+}
+
+// editHorcrux applies edit to the horcrux-file at path
+func editHorcrux(t *testing.T, path string, edit func(yml *ymlFile)) {
+	t.Helper()
+	// Unchecked, so damage can be done in steps
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var yml ymlFile
+	err = yaml.Unmarshal(data, &yml)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edit(&yml)
+	data, err = yaml.Marshal(yml)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(path, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,138 @@
+package commands
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/pepa65/horcrux/pkg/shamir"
+)
+
+// Issue writes horcrux-file index into dir, reconstructed from the horcrux-files in dir:
+// a replacement for a lost horcrux-file (index up to the total) or an additional one
+func Issue(dir string, index int, compress bool, force bool) error {
+	ymls, _, err := readHorcruxes(dir, compress)
+	if err != nil {
+		return err
+	}
+
+	yml := ymls[0]
+	err = yml.keyed()
+	if err != nil {
+		return err
+	}
+
+	if yml.Policy != "" {
+		return errors.New("horcrux-files split along a policy can't be issued, reshare instead")
+	}
+
+	if yml.Field == 16 {
+		return errors.New("horcrux-files split in GF(2^16) can't be issued, reshare instead")
+	}
+
+	if yml.chunked() {
+		return errors.New("all horcrux-files are needed to reconstruct and each holds a different part of the payload, so none can be issued")
+	}
+
+	// In a weighted set only the first index of a horcrux-file can be issued
+	start := 1
+	for _, w := range yml.Weights {
+		if index > start && index < start+w {
+			return fmt.Errorf("index %d is part of horcrux-file %d, issue that instead", index, start)
+		}
+		start += w
+	}
+	yml.Index = index
+	weight := yml.weight()
+
+	// Collect the known x coordinates, later issued horcrux-files know more
+	coords := []byte{}
+	used := map[uint8]bool{}
+	keyparts := [][]byte{}
+	for _, y := range ymls {
+		if index < y.Index+y.weight() && y.Index < index+weight {
+			return fmt.Errorf("horcrux-file with index %d is already present", y.Index)
+		}
+
+		points, err := y.points()
+		if err != nil {
+			return err
+		}
+
+		for _, point := range points {
+			used[point[len(point)-1]] = true
+		}
+		keyparts = append(keyparts, points...)
+		c, err := hex.DecodeString(y.Coords)
+		if err != nil {
+			return errors.New("bad coords")
+		}
+
+		if len(c) > len(coords) {
+			coords = c
+		}
+	}
+	for _, x := range coords {
+		if x != 0 {
+			used[x] = true
+		}
+	}
+
+	points := make([][]byte, weight)
+	for i := range points {
+		x := xCoord(coords, index+i)
+		if x == 0 {
+			if index <= yml.Total {
+				return fmt.Errorf("the coordinate of horcrux-file %d is not recorded, issue an index above %d instead", index, yml.Total)
+			}
+
+			if len(used) >= 255 {
+				return errors.New("no coordinates left to issue a new horcrux-file")
+			}
+
+			if len(coords) < yml.Total {
+				fmt.Println("Warning: the coordinates of the missing horcrux-files are not recorded, the new one could coincide with one of them")
+			}
+			x, err = unusedCoord(used)
+			if err != nil {
+				return err
+			}
+
+			for len(coords) < index {
+				coords = append(coords, 0)
+			}
+			coords[index-1] = x
+		}
+		points[i], err = shamir.Evaluate(keyparts, x)
+		if err != nil {
+			return errors.New("error evaluating the keyparts")
+		}
+	}
+	yml.Coords = hex.EncodeToString(coords)
+	yml.setPoints(points)
+	partname := filepath.Join(dir, partName(yml, compress))
+	err = writeHorcrux(partname, yml, compress, force)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Written: %s\n", partname)
+	return nil
+}
+
+// unusedCoord returns a random x coordinate that is not used yet
+func unusedCoord(used map[uint8]bool) (uint8, error) {
+	b := make([]byte, 1)
+	for {
+		_, err := rand.Read(b)
+		if err != nil {
+			return 0, errors.New("error generating a random coordinate")
+		}
+
+		if b[0] != 0 && !used[b[0]] {
+			return b[0], nil
+		}
+	}
+}
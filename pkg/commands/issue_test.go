@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIssue(t *testing.T) {
+	content := "issued"
+	dir := splitString(t, content, 4, 2, "")
+	lost := filepath.Join(dir, "secret.txt_horcrux3of4.yml")
+	old, err := readHorcrux(lost, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Remove(lost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A replacement is the same as the lost horcrux-file
+	err = Issue(dir, 3, false, false)
+	if err != nil {
+		t.Fatalf("Issue of a replacement: %v", err)
+	}
+
+	yml, err := readHorcrux(lost, false)
+	if err != nil || yml.Keypart != old.Keypart || yml.Set != old.Set {
+		t.Errorf("replacement keypart %s (%v), want %s", yml.Keypart, err, old.Keypart)
+	}
+
+	if Issue(dir, 2, false, false) == nil {
+		t.Error("a horcrux-file that is present was issued")
+	}
+
+	// An additional one works with any other
+	err = Issue(dir, 5, false, false)
+	if err != nil {
+		t.Fatalf("Issue of an additional horcrux-file: %v", err)
+	}
+
+	keepOnly(t, dir, "horcrux1of4.yml", "horcrux5of4.yml")
+	got, err := mergeString(t, dir)
+	if err != nil || got != content {
+		t.Errorf("merge with the additional horcrux-file: got %q (%v), want %q", got, err, content)
+	}
+}
+
+func TestIssueChunked(t *testing.T) {
+	dir := splitString(t, "all needed", 3, 3, "")
+	if Issue(dir, 4, false, false) == nil {
+		t.Error("a horcrux-file was issued for a set that needs all of them")
+	}
+}
@@ -2,6 +2,7 @@ package commands
 
 import (
 	"bytes"
+	"crypto/hmac"
 	"encoding/base64"
 	"encoding/hex"
 	"errors"
@@ -10,6 +11,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 
@@ -18,149 +20,525 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+var errDigest = errors.New("reconstructed file does not match the digest, the horcrux-files are mismatched or damaged")
+
 func Query(filename string) error {
+	yml, err := readHorcrux(filename, strings.HasSuffix(filename, ".horcrux"))
+	if err != nil {
+		return err
+	}
+
+	timestamp := time.Unix(yml.Timestamp, 0)
+	if yml.Archive != "" {
+		fmt.Printf("Directory '%s' was split at %s (packed as %s)\n", yml.Filename, timestamp, yml.Archive)
+	} else {
+		fmt.Printf("File '%s' was split at %s\n", yml.Filename, timestamp)
+	}
+	if yml.Perm != "" {
+		fmt.Printf("Permissions of the file were %s\n", yml.Perm)
+	}
+	if yml.Meta != "" {
+		fmt.Println("The metadata of the file is recorded (encrypted)")
+	}
+	if yml.Set != "" {
+		fmt.Printf("Set %s", yml.Set)
+		if len(yml.Supersedes) > 0 {
+			fmt.Printf(" (supersedes %s)", strings.Join(yml.Supersedes, " "))
+		}
+		fmt.Println()
+	}
+	if yml.Refresh > 0 {
+		fmt.Printf("Refreshed %d times, only combines with horcrux-files refreshed as often\n", yml.Refresh)
+	}
+	if yml.Sub != nil {
+		fmt.Printf("Sub-share %d of %d (minimum of %d needed) of horcrux-file %d:\n", yml.Sub.Index, yml.Sub.Total, yml.Sub.Minimum, yml.Index)
+	}
+	if yml.Field == 16 {
+		fmt.Println("Split in GF(2^16) for more than 255 keyparts")
+	}
+	if yml.Secrets != nil {
+		names := make([]string, len(yml.Secrets))
+		for i, secret := range yml.Secrets {
+			names[i] = secret.Filename
+		}
+		fmt.Printf("Protects %d files: %s\n", len(names), strings.Join(names, " "))
+	}
+	if yml.Policy != "" {
+		fmt.Printf("Horcrux-file %d of %d for holder '%s' (policy %s)\n", yml.Index, yml.Total, yml.Holder, yml.Policy)
+	} else if yml.Mode == ModeRamp {
+		fmt.Printf("Horcrux-file %d of %d in ramp mode (minimum of %d needed to merge, fewer than %d reveal nothing)\n", yml.Index, yml.Total, yml.Minimum, yml.Privacy)
+	} else if yml.Mode == ModeDirect {
+		fmt.Printf("Horcrux-file %d of %d in direct mode, without key (minimum of %d needed to merge)\n", yml.Index, yml.Total, yml.Minimum)
+	} else if yml.Weights != nil {
+		fmt.Printf("Horcrux-file %d carries %d of %d keyparts (minimum of %d keyparts needed to merge)\n", yml.Index, yml.weight(), yml.Total, yml.Minimum)
+	} else if yml.Index > yml.Total {
+		fmt.Printf("Horcrux-file %d, issued in addition to the original %d (minimum of %d needed to merge)\n", yml.Index, yml.Total, yml.Minimum)
+	} else {
+		fmt.Printf("Horcrux-file %d of %d (minimum of %d needed to merge)\n", yml.Index, yml.Total, yml.Minimum)
+	}
+	return nil
+}
+
+// readHorcrux reads and parses a single horcrux-file
+func readHorcrux(filename string, compressed bool) (ymlFile, error) {
+	var yml ymlFile
 	file, err := os.Open(filename)
 	if err != nil {
-		return errors.New("problem reading file")
+		return yml, errors.New("problem reading file")
 	}
 
 	defer file.Close()
 	var data []byte
-	if strings.HasSuffix(filename, ".horcrux") {
+	if compressed {
 		zreader, err := zstd.NewReader(file)
 		if err != nil {
-			return err
+			return yml, err
 		}
 
 		defer zreader.Close()
 		data, err = io.ReadAll(zreader)
 		if err != nil {
-			return err
+			return yml, err
 		}
 	} else {
 		data, err = io.ReadAll(file)
 		if err != nil {
-			return err
+			return yml, err
 		}
 	}
-	var yml ymlFile
 	err = yaml.Unmarshal(data, &yml)
 	if err != nil || yml.Filename == "" {
-		return errors.New("bad YAML")
+		return yml, errors.New("bad YAML")
 	}
 
-	timestamp := time.Unix(yml.Timestamp, 0)
-	fmt.Printf("File '%s' was split at %s\n", yml.Filename, timestamp)
-	fmt.Printf("Horcrux-file %d of %d (minimum of %d needed to merge)\n", yml.Index, yml.Total, yml.Minimum)
-	return nil
+	// The filenames get written to, so they can't lead elsewhere
+	for _, secret := range append([]secretFile{{Filename: yml.Filename}}, yml.Secrets...) {
+		if !plainName(secret.Filename) {
+			return yml, fmt.Errorf("bad filename '%s'", secret.Filename)
+		}
+	}
+
+	return yml, yml.checkDigests()
 }
 
-func Merge(dir string, compressed bool) error {
+// readHorcruxes reads all horcrux-files in dir and checks they belong to the same set,
+// it returns the parsed horcrux-files and their filenames
+func readHorcruxes(dir string, compressed bool) ([]ymlFile, []string, error) {
 	dirfiles, err := ioutil.ReadDir(dir)
 	if err != nil {
-		return errors.New("empty directory")
+		return nil, nil, errors.New("empty directory")
 	}
 
 	filenames := []string{}
 	for _, file := range dirfiles {
 		if (filepath.Ext(file.Name()) == ".yml" && !compressed) || (filepath.Ext(file.Name()) == ".horcrux" && compressed) {
+			if file.Mode().Perm()&0044 != 0 && runtime.GOOS != "windows" {
+				fmt.Printf("Warning: '%s' can be read by others than its owner (mode %s)\n", file.Name(), recordPerm(file.Mode()))
+			}
 			filenames = append(filenames, file.Name())
 		}
 	}
-	var ymls = []ymlFile{}
-	for _, filename := range filenames {
-		file, err := os.Open(filename)
+	all := make([]ymlFile, len(filenames))
+	superseded := map[string]bool{}
+	for i, filename := range filenames {
+		all[i], err = readHorcrux(filepath.Join(dir, filename), compressed)
 		if err != nil {
-			return errors.New("problem reading file")
+			return nil, nil, err
 		}
 
-		defer file.Close()
-		var data []byte
-		if compressed {
-			zreader, err := zstd.NewReader(file)
-			if err != nil {
-				return err
-			}
+		for _, set := range all[i].Supersedes {
+			superseded[set] = true
+		}
+	}
+	var current = []ymlFile{}
+	var currentnames = []string{}
+	for i, yml := range all {
+		if superseded[yml.setID()] {
+			fmt.Printf("Skipping '%s', it has been superseded by a newer set\n", filenames[i])
+			continue
+		}
 
-			defer zreader.Close()
-			data, err = io.ReadAll(zreader)
-			if err != nil {
-				return err
-			}
-		} else {
-			data, err = io.ReadAll(file)
+		current = append(current, yml)
+		currentnames = append(currentnames, filenames[i])
+	}
+	current, currentnames, err = resolveSubshares(current, currentnames)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ymls = []ymlFile{}
+	var names = []string{}
+	var size, count int
+	for i, yml := range current {
+		// Horcrux-files split along a policy carry keyparts of different sizes,
+		// horcrux-files that share the file itself carry shares of the same size
+		points := [][]byte{make([]byte, len(yml.Payload))}
+		if yml.Policy == "" && yml.Mode == "" {
+			points, err = yml.points()
 			if err != nil {
-				return err
+				return nil, nil, errors.New(err.Error() + " in " + currentnames[i])
 			}
 		}
-		var yml ymlFile
-		err = yaml.Unmarshal(data, &yml)
-		if err != nil || yml.Filename == "" {
-			return errors.New("bad YAML")
-		}
 
-		if len(ymls) > 0 && (yml.Filename != ymls[0].Filename || yml.Timestamp != ymls[0].Timestamp || yml.Total != ymls[0].Total || yml.Minimum != ymls[0].Minimum || len(yml.Keypart) != len(ymls[0].Keypart)) {
+		if len(ymls) > 0 && (yml.Filename != ymls[0].Filename || yml.Archive != ymls[0].Archive || yml.Perm != ymls[0].Perm || yml.Meta != ymls[0].Meta || yml.setID() != ymls[0].setID() || yml.Refresh != ymls[0].Refresh || yml.Total != ymls[0].Total || yml.Minimum != ymls[0].Minimum || yml.Field != ymls[0].Field || yml.Mode != ymls[0].Mode || yml.Privacy != ymls[0].Privacy || fmt.Sprint(yml.Weights) != fmt.Sprint(ymls[0].Weights) || yml.Policy != ymls[0].Policy || yml.digests() != ymls[0].digests() || len(points[0]) != size) {
 			fmt.Println("All horcrux-files in the directory must have the same atributes (except index, keypart and payload)")
-			return errors.New("all horcrux-files in the directory must have the same atributes (except index, keypart and payload)")
+			return nil, nil, errors.New("all horcrux-files in the directory must have the same atributes (except index, keypart and payload)")
 		}
+		size = len(points[0])
+		count += len(points)
 		ymls = append(ymls, yml)
+		names = append(names, currentnames[i])
 	}
 	n := len(ymls)
 	if n == 0 {
-		return errors.New("no horcrux-files in directory")
-	} else if n < ymls[0].Minimum {
-		return fmt.Errorf("not enough horcrux-files, %d are needed to reconstruct, only %d here", ymls[0].Minimum, n)
+		return nil, nil, errors.New("no horcrux-files in directory")
+	} else if count < ymls[0].Minimum {
+		if ymls[0].Weights != nil {
+			return nil, nil, fmt.Errorf("not enough keyparts, %d are needed to reconstruct, only %d here (in %d horcrux-files)", ymls[0].Minimum, count, n)
+		}
+		return nil, nil, fmt.Errorf("not enough horcrux-files, %d are needed to reconstruct, only %d here", ymls[0].Minimum, n)
+	}
+
+	return ymls, names, nil
+}
+
+// combineKey reconstructs the key from the keyparts of the horcrux-files
+func combineKey(ymls []ymlFile) ([]byte, error) {
+	if ymls[0].Policy != "" {
+		return combinePolicy(ymls)
 	}
 
-	keyparts := make([][]byte, n)
-	for i := range keyparts {
-		keyparts[i], err = hex.DecodeString(ymls[i].Keypart)
+	keyparts := [][]byte{}
+	for _, yml := range ymls {
+		points, err := yml.points()
 		if err != nil {
-			return err
+			return nil, err
 		}
+
+		keyparts = append(keyparts, points...)
+	}
+	combine := shamir.Combine
+	if ymls[0].Field == 16 {
+		combine = shamir.Combine16
 	}
-	key, err := shamir.Combine(keyparts)
+	key, err := combine(keyparts)
 	if err != nil {
-		return errors.New("problem recombining the keyparts")
+		return nil, errors.New("problem recombining the keyparts")
 	}
 
+	return key, nil
+}
+
+// encrypted returns the encrypted file from the payloads of the horcrux-files
+func encrypted(ymls []ymlFile) ([]byte, error) {
 	var encfile []byte
-	if ymls[0].Total == ymls[0].Minimum {
+	if ymls[0].chunked() {
 		// m == n: Recombine sorted by index
+		n := len(ymls)
 		sortedIndex := make([]int, n)
 		for i := range ymls {
+			if ymls[i].Index < 1 || ymls[i].Index > n {
+				return nil, fmt.Errorf("bad index %d", ymls[i].Index)
+			}
+
 			sortedIndex[ymls[i].Index-1] = i
 		}
 		for i := range sortedIndex {
 			payload, err := base64.StdEncoding.DecodeString(ymls[sortedIndex[i]].Payload)
 			if err != nil {
-				return errors.New("error decoding payload")
+				return nil, errors.New("error decoding payload")
 			}
+
 			encfile = append(encfile, payload...)
 		}
 	} else {
 		// m < n: All files have the same payload
+		var err error
 		encfile, err = base64.StdEncoding.DecodeString(ymls[0].Payload)
 		if err != nil {
-			return errors.New("error decoding payload")
+			return nil, errors.New("error decoding payload")
+		}
+	}
+	return encfile, nil
+}
+
+// unlock reconstructs the key and the encrypted file from the horcrux-files
+func unlock(ymls []ymlFile) ([]byte, []byte, error) {
+	key, err := combineKey(ymls)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encfile, err := encrypted(ymls)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return key, encfile, nil
+}
+
+// reconstruct checks that the horcrux-files combine and returns a function
+// that writes the original file, and one that wipes what it was made from
+func reconstruct(ymls []ymlFile) (func(io.Writer) error, func(), error) {
+	if ymls[0].Mode != "" {
+		var data []byte
+		var err error
+		switch ymls[0].Mode {
+		case ModeRamp:
+			data, err = combineRamp(ymls)
+		case ModeDirect:
+			data, err = combineDirect(ymls)
+		default:
+			err = fmt.Errorf("unknown mode '%s'", ymls[0].Mode)
+		}
+		if err != nil {
+			return nil, nil, err
 		}
+
+		return func(writer io.Writer) error {
+				_, err := writer.Write(data)
+				return err
+			}, func() {
+				clear(data[:cap(data)])
+			}, nil
 	}
-	fileReader := bytes.NewReader(encfile)
+
+	key, encfile, err := unlock(ymls)
 	if err != nil {
-		return errors.New("error processing base64 code")
+		return nil, nil, err
 	}
-	reader := cryptoReader(fileReader, key)
-	newFilename := ymls[0].Filename
-	if fileExists(newFilename) {
-		newFilename = prompt("File '%s' already exists here, give a new file name: ", newFilename)
+
+	wipe := func() {
+		clear(key)
+		clear(encfile)
+	}
+	if ymls[0].Secrets != nil {
+		// All files of a multi-secret set in sequence
+		_, writes, err := secretWriters(ymls[0], key, "")
+		if err != nil {
+			wipe()
+			return nil, nil, err
+		}
+
+		return func(writer io.Writer) error {
+			for _, write := range writes {
+				err := write(writer)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}, wipe, nil
 	}
-	_ = os.Truncate(newFilename, 0)
-	newFile, err := os.OpenFile(newFilename, os.O_WRONLY|os.O_CREATE, 0644)
+
+	return func(writer io.Writer) error {
+		return decrypt(key, encfile, ymls[0].Digest, writer)
+	}, wipe, nil
+}
+
+// decrypt writes the decrypted encfile to writer and checks the result
+// against the digest (returns errDigest on mismatch), which only
+// horcrux-files from before digests lack (see checkDigests)
+func decrypt(key, encfile []byte, digest string, writer io.Writer) error {
+	mac := digester(key)
+	reader := cryptoReader(bytes.NewReader(encfile), key)
+	buf := make([]byte, 32*1024)
+	defer clear(buf)
+	_, err := io.CopyBuffer(io.MultiWriter(writer, mac), reader, buf)
 	if err != nil {
-		return errors.New("problem writing to file " + newFilename)
+		return err
 	}
-	defer newFile.Close()
-	_, err = io.Copy(newFile, reader)
-	fmt.Println("Written: ", newFilename)
+
+	if digest != "" {
+		sum, err := hex.DecodeString(digest)
+		if err != nil || !hmac.Equal(sum, mac.Sum(nil)) {
+			return errDigest
+		}
+	}
+	return nil
+}
+
+// Merge reconstructs the original file (or directory) from the horcrux-files in dir
+// as target says, or all files of a multi-secret set (only the one named selected, when not empty)
+func Merge(dir string, compressed bool, selected string, target Target) error {
+	ymls, _, err := readHorcruxes(dir, compressed)
+	if err != nil {
+		return err
+	}
+
+	if target.Stdout != nil {
+		return mergeStdout(ymls, selected, target.Stdout)
+	}
+
+	if ymls[0].Secrets != nil {
+		key, err := combineKey(ymls)
+		if err != nil {
+			return err
+		}
+
+		defer clear(key)
+		names, writes, err := secretWriters(ymls[0], key, selected)
+		if err != nil {
+			return err
+		}
+
+		if target.Output != "" && len(names) > 1 {
+			return errors.New("these horcrux-files protect several files, select one to write to " + target.Output)
+		}
+
+		metas := map[string]*metadata{}
+		for i, secret := range ymls[0].Secrets {
+			if target.Preserve && secret.Meta != "" {
+				metas[secret.Filename], err = decryptMeta(secret.Meta, subkey(key, i))
+				if err != nil {
+					return errors.New(err.Error() + " (" + secret.Filename + ")")
+				}
+			}
+		}
+		for i, name := range names {
+			path := filepath.Join(target.Dest, name)
+			if target.Output != "" {
+				path = target.Output
+			}
+			mode, err := outputPerm(metas[name].perm(), target.Perm, target.Preserve)
+			if err != nil {
+				return err
+			}
+
+			err = writeOutput(path, target.Collision, mode, metas[name], writes[i])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if selected != "" && selected != ymls[0].Filename {
+		return fmt.Errorf("these horcrux-files only protect '%s'", ymls[0].Filename)
+	}
+
+	write, wipe, err := reconstruct(ymls)
+	if err != nil {
+		return err
+	}
+
+	defer wipe()
+	path := filepath.Join(target.Dest, ymls[0].Filename)
+	if target.Output != "" {
+		path = target.Output
+	}
+	if ymls[0].Archive != "" {
+		return restoreArchive(path, ymls[0].Archive, target.Collision, archiveMask(target.Perm, target.Preserve), write)
+	}
+
+	// The metadata is only decrypted to restore it
+	var meta *metadata
+	recorded := ymls[0].Perm
+	if target.Preserve && ymls[0].Meta != "" {
+		key, err := combineKey(ymls)
+		if err != nil {
+			return err
+		}
+
+		meta, err = decryptMeta(ymls[0].Meta, key)
+		clear(key)
+		if err != nil {
+			return err
+		}
+
+		recorded = meta.perm()
+	}
+	mode, err := outputPerm(recorded, target.Perm, target.Preserve)
+	if err != nil {
+		return err
+	}
+
+	return writeOutput(path, target.Collision, mode, meta, write)
+}
+
+// mergeStdout writes the reconstructed file (the selected one of a multi-secret set) to stdout,
+// only once it is checked against its digest
+func mergeStdout(ymls []ymlFile, selected string, stdout io.Writer) error {
+	secret, err := mergeSecret(ymls, selected)
+	if err != nil {
+		return err
+	}
+
+	defer secret.wipe()
+	_, err = stdout.Write(secret.data)
 	return err
 }
+
+// mergeSecret returns the reconstructed file (the selected one of a multi-secret set)
+// in memory, once it is checked against its digest
+func mergeSecret(ymls []ymlFile, selected string) (*secretBuffer, error) {
+	var write func(io.Writer) error
+	wipe := func() {}
+	if ymls[0].Secrets != nil {
+		if selected == "" && len(ymls[0].Secrets) > 1 {
+			return nil, errors.New("these horcrux-files protect several files, select one to write")
+		}
+
+		key, err := combineKey(ymls)
+		if err != nil {
+			return nil, err
+		}
+
+		wipe = func() { clear(key) }
+		_, writes, err := secretWriters(ymls[0], key, selected)
+		if err != nil {
+			wipe()
+			return nil, err
+		}
+
+		write = writes[0]
+	} else {
+		if selected != "" && selected != ymls[0].Filename {
+			return nil, fmt.Errorf("these horcrux-files only protect '%s'", ymls[0].Filename)
+		}
+
+		var err error
+		write, wipe, err = reconstruct(ymls)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer wipe()
+	secret := &secretBuffer{}
+	err := write(secret)
+	if err != nil {
+		secret.wipe()
+		if err == errDigest {
+			return nil, errors.New(err.Error() + " (nothing written)")
+		}
+
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// writeOutput writes a reconstructed file with write (an existing file is handled
+// according to collision) with permissions perm and the metadata meta (if not nil),
+// it is only put in place when it matches its digest
+func writeOutput(newFilename string, collision string, perm os.FileMode, meta *metadata, write func(io.Writer) error) error {
+	newFilename, err := freePath(newFilename, collision)
+	if err != nil || newFilename == "" {
+		return err
+	}
+
+	err = writeAtomic(newFilename, perm, write)
+	if err == errDigest {
+		return errors.New(err.Error() + " (nothing written)")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if meta != nil {
+		meta.restore(newFilename)
+	}
+	fmt.Println("Written: ", newFilename)
+	return nil
+}
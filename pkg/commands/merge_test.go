@@ -0,0 +1,148 @@
+package commands
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	content := "merged to a file"
+	dir := splitString(t, content, 3, 2, "")
+	dest := t.TempDir()
+	err := Merge(dir, false, "", Target{Dest: dest})
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	checkFile(t, filepath.Join(dest, "secret.txt"), content)
+}
+
+func TestMergeOutput(t *testing.T) {
+	content := "merged to a path"
+	dir := splitString(t, content, 2, 2, "")
+	path := filepath.Join(t.TempDir(), "renamed.txt")
+	err := Merge(dir, false, "", Target{Dest: t.TempDir(), Output: path})
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	checkFile(t, path, content)
+}
+
+func TestMergePerm(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no unix permissions")
+	}
+
+	dir := splitString(t, "kept private", 2, 2, "")
+	for _, path := range setFiles(t, dir, 2) {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode().Perm() != defaultPerm {
+			t.Errorf("%s written with %v, want %v", path, info.Mode().Perm(), defaultPerm)
+		}
+	}
+
+	for _, perm := range []os.FileMode{0, 0640} {
+		dest := t.TempDir()
+		err := Merge(dir, false, "", Target{Dest: dest, Perm: perm})
+		if err != nil {
+			t.Fatalf("Merge: %v", err)
+		}
+
+		want := perm
+		if want == 0 {
+			want = defaultPerm
+		}
+		info, err := os.Stat(filepath.Join(dest, "secret.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode().Perm() != want {
+			t.Errorf("merge with mode %v: written with %v, want %v", perm, info.Mode().Perm(), want)
+		}
+	}
+}
+
+func TestMergeDigestMismatch(t *testing.T) {
+	other := splitString(t, "another file", 2, 2, "")
+	var digest string
+	editHorcruxes(t, other, func(yml *ymlFile) {
+		digest = yml.Digest
+	})
+	dir := splitString(t, "the original", 2, 2, "")
+	editHorcruxes(t, dir, func(yml *ymlFile) {
+		yml.Digest = digest
+	})
+	dest := t.TempDir()
+	err := Merge(dir, false, "", Target{Dest: dest})
+	if err == nil {
+		t.Fatal("Merge accepted a mismatched digest")
+	}
+
+	if _, err := os.Stat(filepath.Join(dest, "secret.txt")); err == nil {
+		t.Error("Merge left the output behind")
+	}
+
+	got, err := mergeString(t, dir)
+	if err == nil || got != "" {
+		t.Errorf("merge to standard output: got %q (%v)", got, err)
+	}
+}
+
+func TestMergeMissingDigest(t *testing.T) {
+	content := "no digest"
+	dir := splitString(t, content, 2, 2, "")
+	editHorcruxes(t, dir, func(yml *ymlFile) {
+		yml.Digest = ""
+	})
+	got, err := mergeString(t, dir)
+	if err == nil || got != "" {
+		t.Fatalf("merge without digest: got %q (%v)", got, err)
+	}
+
+	// Horcrux-files from before digests had no set identifier
+	editHorcruxes(t, dir, func(yml *ymlFile) {
+		yml.Set = ""
+	})
+	got, err = mergeString(t, dir)
+	if err != nil || got != content {
+		t.Fatalf("merge of an old set: got %q (%v), want %q", got, err, content)
+	}
+
+	// Resharing adds a digest
+	err = Reshare(dir, 3, 2, nil, "", Output{})
+	if err != nil {
+		t.Fatalf("Reshare: %v", err)
+	}
+
+	yml, err := readHorcrux(setFiles(t, dir, 3)[0], false)
+	if err != nil || yml.Digest == "" {
+		t.Fatalf("reshared set: digest %q (%v)", yml.Digest, err)
+	}
+
+	got, err = mergeString(t, dir)
+	if err != nil || got != content {
+		t.Errorf("merge of the reshared set: got %q (%v), want %q", got, err, content)
+	}
+}
+
+func TestDigester(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	mac := digester(key)
+	mac.Write([]byte("plaintext"))
+	plain := hmac.New(sha256.New, key)
+	plain.Write([]byte("plaintext"))
+	if bytes.Equal(mac.Sum(nil), plain.Sum(nil)) {
+		t.Error("the digest is keyed with the encryption key itself")
+	}
+}
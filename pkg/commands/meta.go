@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Capture tells which metadata of the original files gets recorded,
+// besides their permissions and mtime
+type Capture struct {
+	Xattrs bool // Extended attributes
+	Owner  bool // Owner and group
+}
+
+// metadata is the metadata of an original file, it is kept encrypted
+// in the horcrux-files, next to the payload
+type metadata struct {
+	Perm   string            `yaml:"perm"`
+	Mtime  time.Time         `yaml:"mtime"`
+	Uid    *int              `yaml:"uid,omitempty"`
+	Gid    *int              `yaml:"gid,omitempty"`
+	Xattrs map[string][]byte `yaml:"xattrs,omitempty"`
+}
+
+// captureMeta returns the metadata of the file at path with info,
+// with what capture asks for
+func captureMeta(path string, info os.FileInfo, capture Capture) (*metadata, error) {
+	meta := &metadata{Perm: recordPerm(info.Mode()), Mtime: info.ModTime()}
+	if capture.Owner {
+		uid, gid, err := fileOwner(info)
+		if err != nil {
+			return nil, err
+		}
+
+		meta.Uid, meta.Gid = &uid, &gid
+	}
+	if capture.Xattrs {
+		var err error
+		meta.Xattrs, err = readXattrs(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the extended attributes of %s: %v", path, err)
+		}
+	}
+	return meta, nil
+}
+
+// perm returns the recorded permissions ("" without metadata)
+func (meta *metadata) perm() string {
+	if meta == nil {
+		return ""
+	}
+	return meta.Perm
+}
+
+// restore gives the file at path the recorded metadata (its permissions are
+// given when writing it), what can't be restored is warned about
+func (meta *metadata) restore(path string) {
+	for name, value := range meta.Xattrs {
+		err := writeXattr(path, name, value)
+		if err != nil {
+			fmt.Printf("Warning: extended attribute '%s' of '%s' not restored: %v\n", name, path, err)
+		}
+	}
+	if meta.Uid != nil && meta.Gid != nil {
+		err := os.Chown(path, *meta.Uid, *meta.Gid)
+		if err != nil {
+			fmt.Printf("Warning: owner %d:%d of '%s' not restored: %v\n", *meta.Uid, *meta.Gid, path, err)
+		}
+	}
+	err := os.Chtimes(path, meta.Mtime, meta.Mtime)
+	if err != nil {
+		fmt.Printf("Warning: modification time of '%s' not restored: %v\n", path, err)
+	}
+}
+
+// metaCipher returns the cipher for the metadata of a file encrypted with key,
+// under a key derived from it (so it never shares a keystream with the payload)
+func metaCipher(key []byte) cipher.AEAD {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("horcrux metadata"))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		panic(err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+
+	return aead
+}
+
+// encryptMeta returns meta encrypted and authenticated for a file encrypted with key,
+// the derived key is only ever used once, so the nonce can be fixed
+func encryptMeta(meta *metadata, key []byte) (string, error) {
+	data, err := yaml.Marshal(meta)
+	if err != nil {
+		return "", err
+	}
+
+	aead := metaCipher(key)
+	nonce := make([]byte, aead.NonceSize())
+	return base64.StdEncoding.EncodeToString(aead.Seal(nil, nonce, data, nil)), nil
+}
+
+// decryptMeta returns the metadata encrypted with encryptMeta for a file encrypted with key
+func decryptMeta(encmeta string, key []byte) (*metadata, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encmeta)
+	if err != nil {
+		return nil, errors.New("error decoding the metadata")
+	}
+
+	aead := metaCipher(key)
+	data, err := aead.Open(nil, make([]byte, aead.NonceSize()), sealed, nil)
+	if err != nil {
+		return nil, errors.New("the metadata doesn't match the key, the horcrux-files are mismatched or damaged")
+	}
+
+	meta := &metadata{}
+	err = yaml.Unmarshal(data, meta)
+	if err != nil {
+		return nil, errors.New("bad metadata")
+	}
+
+	return meta, nil
+}
+
+// reencryptMeta returns encmeta encrypted under key instead of oldkey
+func reencryptMeta(encmeta string, oldkey, key []byte) (string, error) {
+	if encmeta == "" {
+		return "", nil
+	}
+
+	meta, err := decryptMeta(encmeta, oldkey)
+	if err != nil {
+		return "", err
+	}
+
+	return encryptMeta(meta, key)
+}
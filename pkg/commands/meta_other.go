@@ -0,0 +1,25 @@
+//go:build !linux && !darwin
+
+package commands
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoSupport = errors.New("not supported on this system")
+
+// fileOwner returns the user and group that own the file with info
+func fileOwner(info os.FileInfo) (int, int, error) {
+	return 0, 0, errors.New("recording the owner is " + errNoSupport.Error())
+}
+
+// readXattrs returns the extended attributes of the file at path
+func readXattrs(path string) (map[string][]byte, error) {
+	return nil, errNoSupport
+}
+
+// writeXattr sets extended attribute name of the file at path to value
+func writeXattr(path, name string, value []byte) error {
+	return errNoSupport
+}
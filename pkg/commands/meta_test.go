@@ -0,0 +1,120 @@
+package commands
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncryptMeta(t *testing.T) {
+	key, other := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	uid, gid := 1000, 100
+	meta := &metadata{
+		Perm:   "640",
+		Mtime:  time.Date(2024, 2, 29, 12, 30, 0, 0, time.UTC),
+		Uid:    &uid,
+		Gid:    &gid,
+		Xattrs: map[string][]byte{"user.comment": []byte("kept secret")},
+	}
+	encmeta, err := encryptMeta(meta, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(encmeta, "640") || strings.Contains(encmeta, "comment") {
+		t.Error("the metadata is not encrypted")
+	}
+
+	got, err := decryptMeta(encmeta, key)
+	if err != nil || got.Perm != "640" || !got.Mtime.Equal(meta.Mtime) || *got.Uid != uid || *got.Gid != gid ||
+		string(got.Xattrs["user.comment"]) != "kept secret" {
+		t.Fatalf("decryptMeta: got %+v (%v), want %+v", got, err, meta)
+	}
+
+	if _, err := decryptMeta(encmeta, other); err == nil {
+		t.Error("the metadata decrypted under another key")
+	}
+
+	sealed := []byte(encmeta)
+	sealed[4] ^= 'A' ^ 'B'
+	if _, err := decryptMeta(string(sealed), key); err == nil {
+		t.Error("tampered metadata decrypted")
+	}
+
+	reencrypted, err := reencryptMeta(encmeta, key, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = decryptMeta(reencrypted, other)
+	if err != nil || got.Perm != "640" {
+		t.Errorf("reencrypted metadata: got %+v (%v)", got, err)
+	}
+
+	if empty, err := reencryptMeta("", key, other); empty != "" || err != nil {
+		t.Errorf("reencryptMeta of no metadata: %q (%v)", empty, err)
+	}
+}
+
+func TestMergePreserve(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no unix permissions")
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret.txt")
+	writeString(t, path, "with metadata")
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	err := os.Chmod(path, 0640)
+	if err == nil {
+		err = os.Chtimes(path, mtime, mtime)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := filepath.Join(dir, "parts")
+	err = Split(path, "", 2, 2, nil, "", "", 0, Capture{}, Output{Dir: parts})
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+
+	yml, err := readHorcrux(setFiles(t, parts, 2)[0], false)
+	if err != nil || yml.Meta == "" || strings.Contains(yml.Meta, "640") {
+		t.Fatalf("recorded metadata %q (%v)", yml.Meta, err)
+	}
+
+	tests := []struct {
+		preserve bool
+		perm     os.FileMode
+		want     os.FileMode
+	}{
+		{false, 0, 0600},
+		{false, 0644, 0644},
+		{true, 0, 0640},
+	}
+	for _, test := range tests {
+		dest := t.TempDir()
+		err = Merge(parts, false, "", Target{Dest: dest, Perm: test.perm, Preserve: test.preserve})
+		if err != nil {
+			t.Fatalf("Merge: %v", err)
+		}
+
+		info, err := os.Stat(filepath.Join(dest, "secret.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Mode().Perm() != test.want {
+			t.Errorf("preserve %t, perm %o: mode %o, want %o", test.preserve, test.perm, info.Mode().Perm(), test.want)
+		}
+
+		if test.preserve && !info.ModTime().Equal(mtime) {
+			t.Errorf("preserved mtime %v, want %v", info.ModTime(), mtime)
+		}
+	}
+}
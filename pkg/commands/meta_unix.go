@@ -0,0 +1,62 @@
+//go:build linux || darwin
+
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileOwner returns the user and group that own the file with info
+func fileOwner(info os.FileInfo) (int, int, error) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, errors.New("the owner of " + info.Name() + " is unknown")
+	}
+
+	return int(stat.Uid), int(stat.Gid), nil
+}
+
+// readXattrs returns the extended attributes of the file at path
+func readXattrs(path string) (map[string][]byte, error) {
+	size, err := unix.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+
+	list := make([]byte, size)
+	size, err = unix.Listxattr(path, list)
+	if err != nil {
+		return nil, err
+	}
+
+	xattrs := map[string][]byte{}
+	for _, name := range bytes.Split(list[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+
+		size, err := unix.Getxattr(path, string(name), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		value := make([]byte, size)
+		size, err = unix.Getxattr(path, string(name), value)
+		if err != nil {
+			return nil, err
+		}
+
+		xattrs[string(name)] = value[:size]
+	}
+	return xattrs, nil
+}
+
+// writeXattr sets extended attribute name of the file at path to value
+func writeXattr(path, name string, value []byte) error {
+	return unix.Setxattr(path, name, value, 0)
+}
@@ -0,0 +1,145 @@
+package commands
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// secretFile is one of the files protected by a multi-secret set
+type secretFile struct {
+	Filename string `yaml:"filename"`
+	Digest   string `yaml:"digest"`
+	Meta     string `yaml:"meta,omitempty"`
+	Payload  string `yaml:"payload"`
+}
+
+// subkey returns the key that secret i of a multi-secret set is encrypted with,
+// derived from the shared key (so no two files are encrypted under the same key)
+func subkey(key []byte, i int) []byte {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "horcrux secret %d", i)
+	return mac.Sum(nil)
+}
+
+// SplitSecrets encrypts the files at paths under subkeys of one key that gets
+// split into n horcrux-files (m needed to reconstruct), so each holder gets
+// a single horcrux-file for all of the files, written as out says
+// (their metadata is recorded as capture says)
+func SplitSecrets(paths []string, n int, m int, weights []int, policy string, capture Capture, out Output) error {
+	key, err := newKey()
+	if err != nil {
+		return err
+	}
+
+	secrets := make([]secretFile, len(paths))
+	seen := map[string]bool{}
+	for i, path := range paths {
+		filename := filepath.Base(path)
+		if seen[filename] {
+			return fmt.Errorf("more than one file named '%s'", filename)
+		}
+
+		seen[filename] = true
+		file, err := os.Open(path)
+		if err != nil {
+			return errors.New("error opening file " + path)
+		}
+
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return errors.New("error opening file " + path)
+		}
+
+		k := subkey(key, i)
+		mac := digester(k)
+		encfile, err := io.ReadAll(cryptoReader(io.TeeReader(file, mac), k))
+		file.Close()
+		if err != nil {
+			return err
+		}
+
+		meta, err := captureMeta(path, info, capture)
+		if err != nil {
+			return err
+		}
+
+		encmeta, err := encryptMeta(meta, k)
+		if err != nil {
+			return err
+		}
+
+		secrets[i] = secretFile{filename, hex.EncodeToString(mac.Sum(nil)), encmeta, base64.StdEncoding.EncodeToString(encfile)}
+	}
+	yml := ymlFile{Filename: secrets[0].Filename, Weights: weights, Policy: policy, Secrets: secrets}
+	return writeSet(yml, key, nil, n, m, out)
+}
+
+// secretWriters returns the functions that write the files of a multi-secret set
+// with the given key (only the one named selected, when not empty)
+func secretWriters(yml ymlFile, key []byte, selected string) ([]string, []func(io.Writer) error, error) {
+	var names []string
+	var writes []func(io.Writer) error
+	for i, secret := range yml.Secrets {
+		if selected != "" && secret.Filename != selected {
+			continue
+		}
+
+		encfile, err := base64.StdEncoding.DecodeString(secret.Payload)
+		if err != nil {
+			return nil, nil, errors.New("error decoding payload of " + secret.Filename)
+		}
+
+		names = append(names, secret.Filename)
+		writes = append(writes, func(writer io.Writer) error {
+			k := subkey(key, i)
+			defer clear(k)
+			return decrypt(k, encfile, secret.Digest, writer)
+		})
+	}
+	if len(names) == 0 {
+		all := make([]string, len(yml.Secrets))
+		for i, secret := range yml.Secrets {
+			all[i] = secret.Filename
+		}
+		return nil, nil, fmt.Errorf("no file '%s' in these horcrux-files, only: %s", selected, strings.Join(all, " "))
+	}
+
+	return names, writes, nil
+}
+
+// rekeySecrets returns the files of a multi-secret set encrypted under subkeys of key
+// instead of oldkey, checking them against their digests on the way
+func rekeySecrets(secrets []secretFile, oldkey, key []byte) ([]secretFile, error) {
+	newsecrets := make([]secretFile, len(secrets))
+	for i, secret := range secrets {
+		encfile, err := base64.StdEncoding.DecodeString(secret.Payload)
+		if err != nil {
+			return nil, errors.New("error decoding payload of " + secret.Filename)
+		}
+
+		oldsub, sub := subkey(oldkey, i), subkey(key, i)
+		newfile, digest, err := reencrypt(encfile, oldsub, secret.Digest, sub)
+		if err != nil {
+			return nil, errors.New(err.Error() + " (" + secret.Filename + ")")
+		}
+
+		encmeta, err := reencryptMeta(secret.Meta, oldsub, sub)
+		clear(oldsub)
+		clear(sub)
+		if err != nil {
+			return nil, err
+		}
+
+		newsecrets[i] = secretFile{secret.Filename, digest, encmeta, base64.StdEncoding.EncodeToString(newfile)}
+	}
+	return newsecrets, nil
+}
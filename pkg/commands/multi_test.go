@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// splitSecrets splits files with the given names and contents into one set
+// of n horcrux-files of which m reconstruct them, returns the directory they are in
+func splitSecrets(t *testing.T, files map[string]string, n, m int) string {
+	t.Helper()
+	dir := t.TempDir()
+	var paths []string
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		writeString(t, path, content)
+		paths = append(paths, path)
+	}
+	parts := t.TempDir()
+	err := SplitSecrets(paths, n, m, nil, "", Capture{}, Output{Dir: parts})
+	if err != nil {
+		t.Fatalf("SplitSecrets: %v", err)
+	}
+
+	return parts
+}
+
+func TestSplitSecrets(t *testing.T) {
+	files := map[string]string{"db.key": "same content", "api.key": "same content", "tls.key": "other content"}
+	dir := splitSecrets(t, files, 3, 2)
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yml"))
+	if err != nil || len(paths) != 3 {
+		t.Fatalf("SplitSecrets wrote %v (%v), want 3 horcrux-files", paths, err)
+	}
+
+	yml, err := readHorcrux(paths[0], false)
+	if err != nil || len(yml.Secrets) != 3 {
+		t.Fatalf("%d files in the horcrux-file (%v), want 3", len(yml.Secrets), err)
+	}
+
+	// Every file is encrypted under its own key
+	payloads := map[string]bool{}
+	for _, secret := range yml.Secrets {
+		payloads[secret.Payload] = true
+	}
+	if len(payloads) != 3 {
+		t.Error("files with the same content have the same payload")
+	}
+
+	dest := t.TempDir()
+	err = Merge(dir, false, "", Target{Dest: dest})
+	if err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	for name, content := range files {
+		checkFile(t, filepath.Join(dest, name), content)
+	}
+
+	// One of them
+	dest = t.TempDir()
+	err = Merge(dir, false, "tls.key", Target{Dest: dest})
+	if err != nil {
+		t.Fatalf("Merge of a selected file: %v", err)
+	}
+
+	if names := dirNames(t, dest); len(names) != 1 {
+		t.Fatalf("Merge of a selected file wrote %v", names)
+	}
+
+	checkFile(t, filepath.Join(dest, "tls.key"), "other content")
+}
+
+func TestSplitSecretsSelect(t *testing.T) {
+	dir := splitSecrets(t, map[string]string{"a.key": "a", "b.key": "b"}, 2, 2)
+	err := Merge(dir, false, "c.key", Target{Dest: t.TempDir()})
+	want := "no file 'c.key' in these horcrux-files, only: "
+	if err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("Merge returned %v, want %q", err, want)
+	}
+}
+
+func TestSplitSecretsDuplicate(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "a"), filepath.Join(t.TempDir(), "a")
+	writeString(t, first, "first")
+	writeString(t, second, "second")
+	err := SplitSecrets([]string{first, second}, 2, 2, nil, "", Capture{}, Output{Dir: dir})
+	if err == nil {
+		t.Error("two files with the same name were split into one set")
+	}
+}
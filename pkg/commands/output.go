@@ -0,0 +1,192 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Output tells where and how the horcrux-files of a new set get written
+type Output struct {
+	Dir      string      // Directory to write in [default: current]
+	Template string      // Template for the names of the horcrux-files, see path [default: as partName]
+	Perm     os.FileMode // Permissions of the horcrux-files [default: defaultPerm]
+	Compress bool        // Write compressed .horcrux files instead of .yml files
+	Force    bool        // Overwrite existing files
+}
+
+// defaultPerm is the permissions of written files, unless others are asked for
+const defaultPerm os.FileMode = 0600
+
+// perm returns the permissions of the horcrux-files
+func (o Output) perm() os.FileMode {
+	if o.Perm == 0 {
+		return defaultPerm
+	}
+	return o.Perm
+}
+
+// recordPerm returns the permissions of mode as recorded in horcrux-files
+func recordPerm(mode os.FileMode) string {
+	return fmt.Sprintf("%04o", mode.Perm())
+}
+
+// outputPerm returns the permissions for a reconstructed file: the recorded ones
+// with preserve (when there are any), otherwise perm (when not 0) or defaultPerm
+func outputPerm(recorded string, perm os.FileMode, preserve bool) (os.FileMode, error) {
+	if preserve && recorded != "" {
+		mode, err := strconv.ParseUint(recorded, 8, 32)
+		if err != nil || mode > 0777 {
+			return 0, fmt.Errorf("bad permissions '%s' in the horcrux-files", recorded)
+		}
+
+		return os.FileMode(mode), nil
+	}
+
+	if perm == 0 {
+		return defaultPerm, nil
+	}
+	return perm, nil
+}
+
+// archiveMask returns the mask for the archived permissions of a restored directory:
+// with preserve all of them, otherwise perm (or defaultPerm when 0), with execute
+// permission where it gives read permission (so directories can be entered)
+func archiveMask(perm os.FileMode, preserve bool) os.FileMode {
+	if preserve {
+		return 0777
+	}
+
+	if perm == 0 {
+		perm = defaultPerm
+	}
+	return perm | perm&0444>>2
+}
+
+// ext returns the extension of the horcrux-files
+func (o Output) ext() string {
+	if o.Compress {
+		return "horcrux"
+	}
+	return "yml"
+}
+
+// path returns the path of horcrux-file part: in Dir, named after Template with
+// {name}, {holder}, {index}, {total}, {set} and {ext} replaced by the filename, the holder
+// (the index without a policy), the index, the total, the set identifier and the extension,
+// the template can contain directories (like one per horcrux-file: "{index}/{name}.{ext}")
+func (o Output) path(part ymlFile) (string, error) {
+	if o.Template == "" {
+		return filepath.Join(o.Dir, partName(part, o.Compress)), nil
+	}
+
+	holder := part.Holder
+	if holder == "" {
+		holder = strconv.Itoa(part.Index)
+	}
+	name := strings.NewReplacer(
+		"{name}", part.Filename,
+		"{holder}", holder,
+		"{index}", strconv.Itoa(part.Index),
+		"{total}", strconv.Itoa(part.Total),
+		"{set}", part.Set,
+		"{ext}", o.ext(),
+	).Replace(o.Template)
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("template '%s' gives '%s', it should stay inside the output directory", o.Template, name)
+	}
+
+	if filepath.Ext(name) != "."+o.ext() {
+		return "", fmt.Errorf("template '%s' gives '%s', the name should end in '.%s'", o.Template, name, o.ext())
+	}
+
+	return filepath.Join(o.Dir, name), nil
+}
+
+// paths returns the paths of the horcrux-files parts, creating the directories
+// for them that the template asks for
+func (o Output) paths(parts []ymlFile) ([]string, error) {
+	paths := make([]string, len(parts))
+	seen := map[string]bool{}
+	for i, part := range parts {
+		path, err := o.path(part)
+		if err != nil {
+			return nil, err
+		}
+
+		if seen[path] {
+			return nil, fmt.Errorf("template '%s' gives '%s' more than once, use {index}", o.Template, path)
+		}
+
+		seen[path] = true
+		paths[i] = path
+	}
+	for _, path := range paths {
+		err := os.MkdirAll(filepath.Dir(path), 0700)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// Target tells where and how a reconstructed file (or directory) gets written
+type Target struct {
+	Dest      string      // Directory to write in [default: current]
+	Output    string      // Path to write a single file (or directory) to instead
+	Collision string      // What to do with existing files, one of the Collision policies
+	Perm      os.FileMode // Permissions of the files [default: defaultPerm]
+	Preserve  bool        // Restore the recorded permissions and metadata instead of Perm
+	Stdout    io.Writer   // Write the file (or the archive of a directory) here instead
+}
+
+// Policies for reconstructed files (or directories) that already exist
+const (
+	CollisionAsk       = ""           // Ask for another name (standard input must be a terminal)
+	CollisionOverwrite = "overwrite"  // Replace it
+	CollisionKeep      = "no-clobber" // Keep it, and don't write
+	CollisionSuffix    = "suffix"     // Write to the first free name with a numbered suffix
+)
+
+// freePath returns the path to write to when path exists, according to collision
+// ("" when the existing file is kept)
+func freePath(path string, collision string) (string, error) {
+	if _, err := os.Lstat(path); err != nil {
+		return path, nil
+	}
+
+	switch collision {
+	case CollisionOverwrite:
+		return path, nil
+	case CollisionKeep:
+		fmt.Printf("Kept: %s (already exists)\n", path)
+		return "", nil
+	case CollisionSuffix:
+		ext := filepath.Ext(path)
+		base := strings.TrimSuffix(path, ext)
+		for i := 1; ; i++ {
+			free := fmt.Sprintf("%s.%d%s", base, i, ext)
+			if _, err := os.Lstat(free); err != nil {
+				return free, nil
+			}
+		}
+	case CollisionAsk:
+		if !terminal() {
+			return "", fmt.Errorf("'%s' already exists (overwrite, no-clobber or suffix can be chosen)", path)
+		}
+
+		name := prompt("'%s' already exists, give a new name: ", path)
+		if name == "" {
+			return "", fmt.Errorf("'%s' already exists and no new name was given", path)
+		}
+
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(filepath.Dir(path), name)
+		}
+		return freePath(name, collision)
+	}
+	return "", fmt.Errorf("unknown policy '%s' for existing files", collision)
+}
@@ -0,0 +1,196 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestOutputPath(t *testing.T) {
+	part := ymlFile{Filename: "secret.txt", Index: 2, Total: 5}
+	holder := ymlFile{Filename: "secret.txt", Index: 3, Total: 4, Holder: "alice"}
+	newer := ymlFile{Filename: "secret.txt", Index: 2, Total: 5, Set: "0123456789abcdef", Supersedes: []string{"fedcba9876543210"}}
+	tests := []struct {
+		out  Output
+		part ymlFile
+		want string // The path, or the start of the error
+		ok   bool
+	}{
+		{Output{}, part, "secret.txt_horcrux2of5.yml", true},
+		{Output{Dir: "out", Compress: true}, part, "out/secret.txt_2of5.horcrux", true},
+		{Output{Template: "{index}/{name}-{holder}-{index}of{total}.{ext}"}, part, "2/secret.txt-2-2of5.yml", true},
+		{Output{Dir: "out", Template: "{holder}.{ext}", Compress: true}, holder, "out/alice.horcrux", true},
+		{Output{}, newer, "secret.txt_horcrux2of5_0123456789abcdef.yml", true},
+		{Output{Compress: true}, newer, "secret.txt_2of5_0123456789abcdef.horcrux", true},
+		{Output{Template: "{set}/{index}.{ext}"}, newer, "0123456789abcdef/2.yml", true},
+		{Output{Template: "../{name}.{ext}"}, part, "template '../{name}.{ext}' gives '../secret.txt.yml', it should stay inside", false},
+		{Output{Template: "/tmp/{name}.{ext}"}, part, "template '/tmp/{name}.{ext}' gives '/tmp/secret.txt.yml', it should stay inside", false},
+		{Output{Template: "{name}-{index}"}, part, "template '{name}-{index}' gives 'secret.txt-2', the name should end in '.yml'", false},
+		{Output{Template: "{name}.yml", Compress: true}, part, "template '{name}.yml' gives 'secret.txt.yml', the name should end in '.horcrux'", false},
+	}
+	for _, test := range tests {
+		got, err := test.out.path(test.part)
+		if test.ok {
+			if err != nil || got != filepath.FromSlash(test.want) {
+				t.Errorf("path with %+v: got %q (%v), want %q", test.out, got, err, test.want)
+			}
+		} else if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("path with %+v: got %q (%v), want error %q", test.out, got, err, test.want)
+		}
+	}
+}
+
+func TestOutputPaths(t *testing.T) {
+	dir := t.TempDir()
+	parts := []ymlFile{{Filename: "a", Index: 1, Total: 2}, {Filename: "a", Index: 2, Total: 2}}
+	out := Output{Dir: dir, Template: "stick{index}/{name}.{ext}"}
+	paths, err := out.paths(parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, path := range paths {
+		info, err := os.Stat(filepath.Dir(path))
+		if err != nil || !info.IsDir() || filepath.Base(filepath.Dir(path)) != fmt.Sprintf("stick%d", i+1) {
+			t.Errorf("no directory made for %s (%v)", path, err)
+		}
+	}
+
+	out.Template = "{name}.{ext}"
+	_, err = out.paths(parts)
+	if err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Errorf("a template giving the same name twice returned %v", err)
+	}
+}
+
+func TestSplitTemplate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "secret.txt")
+	writeString(t, path, "templated")
+	parts := filepath.Join(dir, "parts")
+	err := Split(path, "", 3, 2, nil, "", "", 0, Capture{}, Output{Dir: parts, Template: "stick{index}/{name}-{index}of{total}.{ext}"})
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+
+	for _, name := range []string{"stick1/secret.txt-1of3.yml", "stick2/secret.txt-2of3.yml", "stick3/secret.txt-3of3.yml"} {
+		if !fileExists(filepath.Join(parts, name)) {
+			t.Errorf("%s not written", name)
+		}
+	}
+}
+
+func TestFreePath(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "secret.txt")
+	writeString(t, existing, "old")
+	writeString(t, filepath.Join(dir, "taken.txt"), "old")
+	writeString(t, filepath.Join(dir, "taken.1.txt"), "old")
+	writeString(t, filepath.Join(dir, "noext"), "old")
+	err := os.Symlink("nowhere", filepath.Join(dir, "dangling"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		collision string
+		want      string // "" when kept, "error" for an error
+	}{
+		{"new.txt", CollisionAsk, "new.txt"},
+		{"new.txt", "bogus", "new.txt"},
+		{"secret.txt", CollisionOverwrite, "secret.txt"},
+		{"secret.txt", CollisionKeep, ""},
+		{"secret.txt", CollisionSuffix, "secret.1.txt"},
+		{"taken.txt", CollisionSuffix, "taken.2.txt"},
+		{"noext", CollisionSuffix, "noext.1"},
+		{"dangling", CollisionSuffix, "dangling.1"},
+		{"secret.txt", "bogus", "error"},
+	}
+	for _, test := range tests {
+		got, err := freePath(filepath.Join(dir, test.name), test.collision)
+		switch {
+		case test.want == "error":
+			if err == nil {
+				t.Errorf("freePath(%s, %q) = %q, want an error", test.name, test.collision, got)
+			}
+		case err != nil:
+			t.Errorf("freePath(%s, %q): %v", test.name, test.collision, err)
+		case test.want == "" && got != "", test.want != "" && got != filepath.Join(dir, test.want):
+			t.Errorf("freePath(%s, %q) = %q, want %q", test.name, test.collision, got, test.want)
+		}
+	}
+	// Without a terminal to ask there is no other name
+	if _, err := freePath(existing, CollisionAsk); err == nil && !terminal() {
+		t.Error("freePath asked for a name without a terminal")
+	}
+}
+
+func TestMergeCollision(t *testing.T) {
+	dir := splitString(t, "new content", 2, 2, "")
+	tests := []struct {
+		collision string
+		want      string
+		suffixed  bool
+	}{
+		{CollisionKeep, "old content", false},
+		{CollisionSuffix, "old content", true},
+		{CollisionOverwrite, "new content", false},
+	}
+	for _, test := range tests {
+		t.Run(test.collision, func(t *testing.T) {
+			dest := t.TempDir()
+			path := filepath.Join(dest, "secret.txt")
+			writeString(t, path, "old content")
+			err := Merge(dir, false, "", Target{Dest: dest, Collision: test.collision})
+			if err != nil {
+				t.Fatalf("Merge: %v", err)
+			}
+
+			checkFile(t, path, test.want)
+			if test.suffixed {
+				checkFile(t, filepath.Join(dest, "secret.1.txt"), "new content")
+			}
+		})
+	}
+}
+
+func TestMergeOverwriteKind(t *testing.T) {
+	// A file doesn't replace a directory of the same name
+	dir := splitString(t, "a file", 2, 2, "")
+	dest := t.TempDir()
+	keep := filepath.Join(dest, "secret.txt", "keep")
+	os.Mkdir(filepath.Dir(keep), 0700)
+	writeString(t, keep, "important")
+	err := Merge(dir, false, "", Target{Dest: dest, Collision: CollisionOverwrite})
+	if err == nil {
+		t.Fatal("Merge replaced a directory with a file")
+	}
+
+	checkFile(t, keep, "important")
+
+	// A directory doesn't replace a file of the same name
+	src := filepath.Join(t.TempDir(), "tree")
+	os.Mkdir(src, 0700)
+	writeString(t, filepath.Join(src, "a"), "archived")
+	parts := t.TempDir()
+	err = Split(src, "", 2, 2, nil, "", "", 0, Capture{}, Output{Dir: parts})
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+
+	file := filepath.Join(dest, "tree")
+	writeString(t, file, "important")
+	err = Merge(parts, false, "", Target{Dest: dest, Collision: CollisionOverwrite})
+	if err == nil {
+		t.Fatal("Merge replaced a file with a directory")
+	}
+
+	checkFile(t, file, "important")
+	if names := dirNames(t, dest); !slices.Equal(names, []string{"secret.txt", "tree"}) {
+		t.Errorf("left behind: %v", names)
+	}
+}
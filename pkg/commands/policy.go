@@ -0,0 +1,309 @@
+package commands
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pepa65/horcrux/pkg/shamir"
+)
+
+// policy is a node in an access structure: a holder (leaf) or a threshold
+// of its children, like "and(eng=2(alice,bob,carol),legal=or(dave,erin))"
+type policy struct {
+	label     string    // Optional name of a group
+	holder    string    // Name of the holder for a leaf
+	threshold int       // Number of children needed
+	children  []*policy // Children of a threshold
+}
+
+// parsePolicy parses a policy expression: a holder name, or a threshold
+// "M(ITEM,...)" "and(ITEM,...)" "or(ITEM,...)", optionally labelled "LABEL=..."
+func parsePolicy(expr string) (*policy, error) {
+	p := policyParser{s: strings.ReplaceAll(expr, " ", "")}
+	node, err := p.item()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.s) {
+		return nil, fmt.Errorf("unexpected '%s' at position %d of the policy", p.s[p.pos:], p.pos+1)
+	}
+
+	if node.holder != "" {
+		return nil, errors.New("the policy should be a threshold, not a single holder")
+	}
+
+	// A holder counting more than once would satisfy a threshold alone
+	seen := map[string]bool{}
+	for _, name := range node.holders() {
+		if seen[name] {
+			return nil, fmt.Errorf("holder '%s' appears more than once in the policy", name)
+		}
+
+		seen[name] = true
+	}
+	return node, nil
+}
+
+type policyParser struct {
+	s   string
+	pos int
+}
+
+// word returns the name at the current position
+func (p *policyParser) word() string {
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune("(),=", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// item parses a holder or a (labelled) threshold
+func (p *policyParser) item() (*policy, error) {
+	node := &policy{}
+	word := p.word()
+	if p.pos < len(p.s) && p.s[p.pos] == '=' {
+		p.pos++
+		node.label = word
+		word = p.word()
+		if p.pos == len(p.s) || p.s[p.pos] != '(' {
+			return nil, fmt.Errorf("group '%s' should be a threshold", node.label)
+		}
+	}
+	if word == "" {
+		return nil, fmt.Errorf("missing name at position %d of the policy", p.pos+1)
+	}
+
+	if p.pos == len(p.s) || p.s[p.pos] != '(' {
+		node.holder = word
+		return node, nil
+	}
+
+	p.pos++
+	for {
+		child, err := p.item()
+		if err != nil {
+			return nil, err
+		}
+
+		node.children = append(node.children, child)
+		if p.pos == len(p.s) {
+			return nil, errors.New("missing ')' at the end of the policy")
+		}
+
+		p.pos++
+		if p.s[p.pos-1] == ')' {
+			break
+		}
+
+		if p.s[p.pos-1] != ',' {
+			return nil, fmt.Errorf("unexpected '%c' at position %d of the policy", p.s[p.pos-1], p.pos)
+		}
+	}
+	k := len(node.children)
+	switch word {
+	case "and":
+		node.threshold = k
+	case "or":
+		node.threshold = 1
+	default:
+		t, err := strconv.Atoi(word)
+		if err != nil {
+			return nil, fmt.Errorf("threshold should be a number, 'and' or 'or': '%s'", word)
+		}
+
+		node.threshold = t
+	}
+	if node.threshold < 1 || node.threshold > k || k > 255 {
+		return nil, fmt.Errorf("threshold %s needs 1..%d of at most 255 items", word, k)
+	}
+
+	return node, nil
+}
+
+// String returns the policy in canonical form
+func (node *policy) String() string {
+	if node.holder != "" {
+		return node.holder
+	}
+
+	items := make([]string, len(node.children))
+	for i, child := range node.children {
+		items[i] = child.String()
+	}
+	s := fmt.Sprintf("%d(%s)", node.threshold, strings.Join(items, ","))
+	if node.label != "" {
+		s = node.label + "=" + s
+	}
+	return s
+}
+
+// holders returns the names of all holders in order of appearance
+func (node *policy) holders() []string {
+	if node.holder != "" {
+		return []string{node.holder}
+	}
+
+	names := []string{}
+	for _, child := range node.children {
+		names = append(names, child.holders()...)
+	}
+	return names
+}
+
+// split shares secret along the policy, the keyparts of each holder
+// are stored in branches by holder name and path in the policy
+func (node *policy) split(secret []byte, path string, branches map[string]map[string]string) error {
+	if node.holder != "" {
+		if branches[node.holder] == nil {
+			branches[node.holder] = map[string]string{}
+		}
+		branches[node.holder][path] = hex.EncodeToString(secret)
+		return nil
+	}
+
+	parts, err := shamir.Split(secret, len(node.children), node.threshold)
+	if err != nil {
+		return err
+	}
+
+	for i, child := range node.children {
+		err = child.split(parts[i], childPath(path, i), branches)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// combine reconstructs the secret at path from the available keyparts by path
+func (node *policy) combine(path string, have map[string][]byte) ([]byte, bool) {
+	if node.holder != "" {
+		part, ok := have[path]
+		return part, ok
+	}
+
+	parts := [][]byte{}
+	for i, child := range node.children {
+		part, ok := child.combine(childPath(path, i), have)
+		if ok {
+			parts = append(parts, part)
+		}
+		if len(parts) == node.threshold {
+			secret, err := shamir.Combine(parts)
+			return secret, err == nil
+		}
+	}
+	return nil, false
+}
+
+// satisfied tells whether the holders with the given names satisfy the policy
+func (node *policy) satisfied(names map[string]bool) bool {
+	if node.holder != "" {
+		return names[node.holder]
+	}
+
+	count := 0
+	for _, child := range node.children {
+		if child.satisfied(names) {
+			count++
+		}
+	}
+	return count >= node.threshold
+}
+
+// missing explains what is still needed to satisfy the policy
+// with the holders with the given names ("" when satisfied)
+func (node *policy) missing(names map[string]bool) string {
+	if node.satisfied(names) {
+		return ""
+	}
+
+	if node.holder != "" {
+		return node.holder
+	}
+
+	count, needs := 0, []string{}
+	for _, child := range node.children {
+		if child.satisfied(names) {
+			count++
+		} else {
+			needs = append(needs, child.missing(names))
+		}
+	}
+	s := fmt.Sprintf("%d more of [%s]", node.threshold-count, strings.Join(needs, ", "))
+	if node.label != "" {
+		s = node.label + ": " + s
+	}
+	return s
+}
+
+// childPath returns the path of child i of the node at path
+func childPath(path string, i int) string {
+	if path == "" {
+		return fmt.Sprint(i + 1)
+	}
+	return fmt.Sprintf("%s.%d", path, i+1)
+}
+
+// combinePolicy reconstructs the key from horcrux-files split along a policy
+func combinePolicy(ymls []ymlFile) ([]byte, error) {
+	node, err := parsePolicy(ymls[0].Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	have, names := map[string][]byte{}, map[string]bool{}
+	for _, yml := range ymls {
+		names[yml.Holder] = true
+		for path, part := range yml.Branches {
+			have[path], err = hex.DecodeString(part)
+			if err != nil {
+				return nil, errors.New("bad keypart")
+			}
+		}
+	}
+	if !node.satisfied(names) {
+		return nil, errors.New("policy not satisfied, still needed: " + node.missing(names))
+	}
+
+	key, ok := node.combine("", have)
+	if !ok {
+		return nil, errors.New("problem recombining the keyparts")
+	}
+
+	return key, nil
+}
+
+// policyParts returns the horcrux-files of yml for all holders in its policy
+func policyParts(yml ymlFile, key, encfile []byte) ([]ymlFile, error) {
+	node, err := parsePolicy(yml.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	branches := map[string]map[string]string{}
+	err = node.split(key, "", branches)
+	if err != nil {
+		return nil, errors.New("error splitting the key")
+	}
+
+	holders := node.holders()
+	yml.Policy = node.String()
+	yml.Total = len(holders)
+	yml.Minimum = 0
+	yml.Payload = base64.StdEncoding.EncodeToString(encfile)
+	parts := make([]ymlFile, len(holders))
+	for i, holder := range holders {
+		yml.Index = i + 1
+		yml.Holder = holder
+		yml.Branches = branches[holder]
+		parts[i] = yml
+	}
+	return parts, nil
+}
@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string // Canonical form, or the start of the error
+		ok   bool
+	}{
+		{"2(alice,bob,carol)", "2(alice,bob,carol)", true},
+		{"and(eng=2(alice, bob, carol), legal=or(dave,erin))", "2(eng=2(alice,bob,carol),legal=1(dave,erin))", true},
+		{"or(alice,and(bob,carol))", "1(alice,2(bob,carol))", true},
+		{"alice", "the policy should be a threshold", false},
+		{"2(alice,bob", "missing ')'", false},
+		{"2(alice,bob))", "unexpected ')'", false},
+		{"3(alice,bob)", "threshold 3 needs 1..2", false},
+		{"0(alice,bob)", "threshold 0 needs 1..2", false},
+		{"some(alice,bob)", "threshold should be a number", false},
+		{"2(alice,,bob)", "missing name", false},
+		{"eng=alice", "group 'eng' should be a threshold", false},
+		{"2(alice,bob,alice)", "holder 'alice' appears more than once", false},
+		{"and(2(alice,bob),or(carol,bob))", "holder 'bob' appears more than once", false},
+	}
+	for _, test := range tests {
+		node, err := parsePolicy(test.expr)
+		if test.ok {
+			if err != nil || node.String() != test.want {
+				t.Errorf("parsePolicy(%q) = %v (%v), want %s", test.expr, node, err, test.want)
+			}
+		} else if err == nil || !strings.HasPrefix(err.Error(), test.want) {
+			t.Errorf("parsePolicy(%q) returned error %v, want %q", test.expr, err, test.want)
+		}
+	}
+}
+
+func TestSatisfied(t *testing.T) {
+	node, err := parsePolicy("and(eng=2(alice,bob,carol),legal=or(dave,erin))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		names   string
+		missing string
+	}{
+		{"alice,bob,dave", ""},
+		{"carol,bob,erin,dave", ""},
+		{"alice,dave", "1 more of [eng: 1 more of [bob, carol]]"},
+		{"alice,bob", "1 more of [legal: 1 more of [dave, erin]]"},
+		{"", "2 more of [eng: 2 more of [alice, bob, carol], legal: 1 more of [dave, erin]]"},
+		{"alice,alice,erin", "1 more of [eng: 1 more of [bob, carol]]"},
+	}
+	for _, test := range tests {
+		names := map[string]bool{}
+		for _, name := range strings.Split(test.names, ",") {
+			if name != "" {
+				names[name] = true
+			}
+		}
+		if node.satisfied(names) != (test.missing == "") {
+			t.Errorf("satisfied by %s: %t", test.names, node.satisfied(names))
+		}
+
+		if got := node.missing(names); got != test.missing {
+			t.Errorf("missing with %s: %q, want %q", test.names, got, test.missing)
+		}
+	}
+}
+
+func TestPolicySplit(t *testing.T) {
+	content := "shared along a policy"
+	path := filepath.Join(t.TempDir(), "secret.txt")
+	writeString(t, path, content)
+	parts := t.TempDir()
+	policy := "and(eng=2(alice,bob,carol),legal=or(dave,erin))"
+	err := Split(path, "", 0, 0, nil, policy, "", 0, Capture{}, Output{Dir: parts})
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+
+	// A horcrux-file for every holder, in the order of the policy
+	names := dirNames(t, parts)
+	if len(names) != 5 {
+		t.Fatalf("Split wrote %v", names)
+	}
+
+	holders := map[string]string{}
+	for i, holder := range []string{"alice", "bob", "carol", "dave", "erin"} {
+		holders[holder] = names[i]
+		yml, err := readHorcrux(filepath.Join(parts, names[i]), false)
+		if err != nil || yml.Holder != holder {
+			t.Fatalf("%s: holder %q (%v), want %s", names[i], yml.Holder, err, holder)
+		}
+	}
+	tests := []struct {
+		holders string
+		ok      bool
+	}{
+		{"alice bob dave", true},
+		{"bob carol erin", true},
+		{"alice bob carol", false},
+		{"alice dave erin", false},
+	}
+	for _, test := range tests {
+		subset := t.TempDir()
+		for _, holder := range strings.Fields(test.holders) {
+			data, err := os.ReadFile(filepath.Join(parts, holders[holder]))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = os.WriteFile(filepath.Join(subset, holders[holder]), data, 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := mergeString(t, subset)
+		if test.ok && (err != nil || got != content) {
+			t.Errorf("merge with %s: got %q (%v), want %q", test.holders, got, err, content)
+		}
+
+		if !test.ok && (err == nil || !strings.Contains(err.Error(), "policy not satisfied")) {
+			t.Errorf("merge with %s: got %q (%v), want an unsatisfied policy", test.holders, got, err)
+		}
+	}
+}
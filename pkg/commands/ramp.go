@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/pepa65/horcrux/pkg/shamir"
+)
+
+// ModeRamp shares the file itself in a ramp scheme instead of an encryption key
+const ModeRamp = "ramp"
+
+// seal prepends the length and appends the SHA-256 of data, so it can be
+// checked after reconstruction (the hash is only visible to enough holders)
+func seal(data []byte) []byte {
+	sealed := binary.BigEndian.AppendUint64(nil, uint64(len(data)))
+	sealed = append(sealed, data...)
+	sum := sha256.Sum256(data)
+	return append(sealed, sum[:]...)
+}
+
+// unseal returns the data from sealed (possibly padded) data after checking its hash
+func unseal(sealed []byte) ([]byte, error) {
+	if len(sealed) < 8+sha256.Size {
+		return nil, errDigest
+	}
+
+	length := binary.BigEndian.Uint64(sealed)
+	if length > uint64(len(sealed)-8-sha256.Size) {
+		return nil, errDigest
+	}
+
+	data := sealed[8 : 8+length]
+	sum := sha256.Sum256(data)
+	if !bytes.Equal(sum[:], sealed[8+length:8+length+sha256.Size]) {
+		return nil, errDigest
+	}
+
+	return data, nil
+}
+
+// rampParts returns the n horcrux-files of yml that share data directly,
+// m of them reconstruct it and fewer than yml.Privacy reveal nothing
+func rampParts(yml ymlFile, data []byte, n int, m int) ([]ymlFile, error) {
+	shares, err := shamir.SplitRamp(seal(data), n, m, yml.Privacy)
+	if err != nil {
+		return nil, errors.New("error splitting the file: " + err.Error())
+	}
+
+	yml.Total = n
+	yml.Minimum = m
+	parts := make([]ymlFile, n)
+	for i, share := range shares {
+		yml.Index = i + 1
+		yml.Payload = base64.StdEncoding.EncodeToString(share)
+		parts[i] = yml
+	}
+	return parts, nil
+}
+
+// combineRamp reconstructs the file from horcrux-files in ramp mode
+func combineRamp(ymls []ymlFile) ([]byte, error) {
+	if len(ymls) < ymls[0].Minimum {
+		return nil, fmt.Errorf("not enough horcrux-files, %d are needed to reconstruct, only %d here", ymls[0].Minimum, len(ymls))
+	}
+
+	shares := make([][]byte, len(ymls))
+	for i, yml := range ymls {
+		var err error
+		shares[i], err = base64.StdEncoding.DecodeString(yml.Payload)
+		if err != nil {
+			return nil, errors.New("error decoding payload")
+		}
+	}
+	sealed, err := shamir.CombineRamp(shares, ymls[0].Minimum, ymls[0].Privacy)
+	if err != nil {
+		return nil, errors.New("problem recombining the shares: " + err.Error())
+	}
+
+	data, err := unseal(sealed)
+	if err != nil {
+		clear(sealed)
+	}
+	return data, err
+}
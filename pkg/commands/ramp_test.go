@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRamp(t *testing.T) {
+	content := strings.Repeat("shared in a ramp\n", 50)
+	dir := splitString(t, content, 5, 3, ModeRamp)
+	yml, err := readHorcrux(setFiles(t, dir, 5)[0], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if yml.Mode != ModeRamp || yml.Privacy != 2 || len(yml.Payload) >= len(content) {
+		t.Errorf("horcrux-file in ramp mode: mode %q, privacy %d, payload of %d bytes", yml.Mode, yml.Privacy, len(yml.Payload))
+	}
+
+	keepOnly(t, dir, "horcrux1of5.yml", "horcrux3of5.yml", "horcrux5of5.yml")
+	got, err := mergeString(t, dir)
+	if err != nil || got != content {
+		t.Errorf("merge of 3 out of 5: got %d bytes (%v), want %d", len(got), err, len(content))
+	}
+
+	keepOnly(t, dir, "horcrux1of5.yml", "horcrux3of5.yml")
+	got, err = mergeString(t, dir)
+	if err == nil || got != "" {
+		t.Errorf("merge of 2 out of 5 with minimum 3: got %q (%v)", got, err)
+	}
+
+	if Reshare(dir, 0, 0, nil, "", Output{}) == nil {
+		t.Error("horcrux-files in ramp mode were reshared")
+	}
+}
+
+func TestSeal(t *testing.T) {
+	data := []byte("sealed data")
+	sealed := seal(data)
+	got, err := unseal(append(sealed, 0, 0, 0))
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("unseal of padded data: got %q (%v)", got, err)
+	}
+
+	changed := bytes.Clone(sealed)
+	changed[8] ^= 1
+	for name, bad := range map[string][]byte{
+		"short":     sealed[:10],
+		"truncated": sealed[:len(sealed)-1],
+		"changed":   changed,
+	} {
+		if _, err := unseal(bad); err != errDigest {
+			t.Errorf("unseal of %s data returned %v, want errDigest", name, err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package commands
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pepa65/horcrux/pkg/shamir"
+	"gopkg.in/yaml.v3"
+)
+
+// Refreshing happens in rounds, without ever reconstructing the key:
+// each holder runs Update on their horcrux-file, and hands the resulting
+// sub-update files to the holders they are addressed to. When all sub-updates
+// have arrived, each holder runs Apply on their horcrux-file.
+// Afterwards old horcrux-files can't be combined with refreshed ones.
+
+// Update writes the sub-updates of horcrux-file path for all holders
+// of its set into the directory of path
+func Update(path string, force bool) error {
+	yml, points, indexes, xs, _, err := refreshable(path)
+	if err != nil {
+		return err
+	}
+
+	updates, err := shamir.RefreshUpdates(len(points[0])-1, yml.Minimum, xs)
+	if err != nil {
+		return err
+	}
+
+	names := []string{}
+	for i, update := range updates {
+		upd := updateFile{
+			Filename: yml.Filename,
+			Set:      yml.setID(),
+			Refresh:  yml.Refresh + 1,
+			From:     yml.Index,
+			To:       indexes[i],
+			Update:   hex.EncodeToString(update),
+		}
+		data, err := yaml.Marshal(upd)
+		if err != nil {
+			return err
+		}
+
+		name := filepath.Join(filepath.Dir(path), fmt.Sprintf("%s_update%dto%d.refresh", yml.Filename, upd.From, upd.To))
+		if !force && fileExists(name) {
+			return fmt.Errorf("file '%s' already exists", name)
+		}
+
+		err = os.WriteFile(name, data, 0600)
+		if err != nil {
+			return err
+		}
+
+		names = append(names, name)
+	}
+	fmt.Printf("Written: %s\n", strings.Join(names, " "))
+	fmt.Println("Hand each sub-update file to the holder of the horcrux-file it is addressed to")
+	return nil
+}
+
+// Apply applies the sub-updates from all holders in the directory of
+// horcrux-file path to it, and removes the applied sub-update files
+func Apply(path string) error {
+	yml, points, _, _, dealers, err := refreshable(path)
+	if err != nil {
+		return err
+	}
+
+	names, err := filepath.Glob(filepath.Join(filepath.Dir(path), "*.refresh"))
+	if err != nil {
+		return err
+	}
+
+	// Sub-updates by the index of the receiving keypart and the index of the dealer
+	found := map[int]map[int][]byte{}
+	for i := range points {
+		found[yml.Index+i] = map[int][]byte{}
+	}
+	used := []string{}
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		var upd updateFile
+		err = yaml.Unmarshal(data, &upd)
+		if err != nil || upd.Filename != yml.Filename || upd.Set != yml.setID() || found[upd.To] == nil {
+			continue
+		}
+
+		if upd.Refresh != yml.Refresh+1 {
+			fmt.Printf("Skipping '%s', it is for refresh round %d\n", name, upd.Refresh)
+			continue
+		}
+
+		if found[upd.To][upd.From] != nil {
+			return fmt.Errorf("more than one sub-update from horcrux-file %d to keypart %d", upd.From, upd.To)
+		}
+
+		found[upd.To][upd.From], err = hex.DecodeString(upd.Update)
+		if err != nil {
+			return errors.New("bad sub-update in " + name)
+		}
+
+		used = append(used, name)
+	}
+	for i := range points {
+		updates, missing := [][]byte{}, []string{}
+		for _, dealer := range dealers {
+			update := found[yml.Index+i][dealer]
+			if update == nil {
+				missing = append(missing, fmt.Sprint(dealer))
+			}
+			updates = append(updates, update)
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("missing sub-updates to keypart %d from horcrux-files %s", yml.Index+i, strings.Join(missing, ", "))
+		}
+
+		points[i], err = shamir.ApplyRefresh(points[i], updates)
+		if err != nil {
+			return err
+		}
+	}
+	yml.setPoints(points)
+	yml.Refresh++
+	err = writeHorcrux(path, yml, strings.HasSuffix(path, ".horcrux"), true)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range used {
+		os.Remove(name)
+	}
+	fmt.Printf("Refreshed: %s (round %d)\n", path, yml.Refresh)
+	return nil
+}
+
+// refreshable reads horcrux-file path and returns it with its keyparts, the indexes
+// and x coordinates of all keyparts in its set, and the indexes of all horcrux-files
+func refreshable(path string) (ymlFile, [][]byte, []int, []uint8, []int, error) {
+	yml, err := readHorcrux(path, strings.HasSuffix(path, ".horcrux"))
+	if err != nil {
+		return yml, nil, nil, nil, nil, err
+	}
+
+	err = yml.keyed()
+	if err != nil {
+		return yml, nil, nil, nil, nil, err
+	}
+
+	if yml.Policy != "" {
+		return yml, nil, nil, nil, nil, errors.New("horcrux-files split along a policy can't be refreshed, rekey instead")
+	}
+
+	if yml.Field == 16 {
+		return yml, nil, nil, nil, nil, errors.New("horcrux-files split in GF(2^16) can't be refreshed, rekey instead")
+	}
+
+	if yml.Sub != nil {
+		return yml, nil, nil, nil, nil, errors.New("sub-shares can't be refreshed, refresh the horcrux-file they were split from")
+	}
+
+	coords, err := hex.DecodeString(yml.Coords)
+	if err != nil || len(coords) == 0 {
+		return yml, nil, nil, nil, nil, errors.New("the coordinates of the horcrux-files are not recorded (split with an older version), reshare first")
+	}
+
+	// The horcrux-files of the split don't know those issued later, so they wouldn't send them sub-updates
+	if len(coords) > yml.Total {
+		return yml, nil, nil, nil, nil, errors.New("horcrux-files were issued beyond the split, the others don't know them, reshare or rekey instead")
+	}
+
+	points, err := yml.points()
+	if err != nil {
+		return yml, nil, nil, nil, nil, err
+	}
+
+	for i, point := range points {
+		if point[len(point)-1] != xCoord(coords, yml.Index+i) {
+			return yml, nil, nil, nil, nil, errors.New("bad keypart")
+		}
+	}
+	indexes, xs, dealers := []int{}, []uint8{}, []int{}
+	for i, x := range coords {
+		if x != 0 {
+			indexes = append(indexes, i+1)
+			xs = append(xs, x)
+		}
+	}
+	// In a weighted set a horcrux-file carrying several keyparts is one dealer
+	start := 1
+	for _, w := range yml.Weights {
+		dealers = append(dealers, start)
+		start += w
+	}
+	for _, index := range indexes {
+		if index >= start {
+			dealers = append(dealers, index)
+		}
+	}
+	return yml, points, indexes, xs, dealers, nil
+}
@@ -0,0 +1,116 @@
+package commands
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRefresh(t *testing.T) {
+	content := "refreshed without reconstructing"
+	dir := splitString(t, content, 3, 2, "")
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yml"))
+	if err != nil || len(paths) != 3 {
+		t.Fatalf("horcrux-files: %v %v", paths, err)
+	}
+
+	old := map[string][]byte{}
+	for _, path := range paths {
+		old[path], err = os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = Update(path, false)
+		if err != nil {
+			t.Fatalf("Update %s: %v", path, err)
+		}
+	}
+	for _, path := range paths {
+		err = Apply(path)
+		if err != nil {
+			t.Fatalf("Apply %s: %v", path, err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil || bytes.Equal(data, old[path]) {
+			t.Errorf("%s didn't change (%v)", path, err)
+		}
+
+		yml, err := readHorcrux(path, false)
+		if err != nil || yml.Refresh != 1 {
+			t.Errorf("%s: refresh round %d (%v), want 1", path, yml.Refresh, err)
+		}
+	}
+	if names, _ := filepath.Glob(filepath.Join(dir, "*.refresh")); len(names) != 0 {
+		t.Errorf("sub-update files left behind: %v", names)
+	}
+
+	got, err := mergeString(t, dir)
+	if err != nil || got != content {
+		t.Errorf("merge after refresh: got %q (%v), want %q", got, err, content)
+	}
+
+	// A refreshed horcrux-file together with an old one doesn't give the key
+	mixed := t.TempDir()
+	for i, path := range paths[:2] {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i == 0 {
+			data = old[path]
+		}
+
+		err = os.WriteFile(filepath.Join(mixed, filepath.Base(path)), data, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err = mergeString(t, mixed)
+	if err == nil || got == content {
+		t.Errorf("old and refreshed horcrux-files merged: got %q (%v)", got, err)
+	}
+}
+
+func TestApplyMissing(t *testing.T) {
+	dir := splitString(t, "secret", 3, 2, "")
+	paths, err := filepath.Glob(filepath.Join(dir, "*.yml"))
+	if err != nil || len(paths) != 3 {
+		t.Fatalf("horcrux-files: %v %v", paths, err)
+	}
+
+	err = Update(paths[0], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if Apply(paths[1]) == nil {
+		t.Error("Apply went ahead without the sub-updates of all holders")
+	}
+}
+
+func TestRefreshIssued(t *testing.T) {
+	dir := splitString(t, "secret", 3, 2, "")
+	err := Issue(dir, 4, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The others don't know horcrux-file 4, so it would never get its sub-updates
+	issued := filepath.Join(dir, "secret.txt_horcrux4of3.yml")
+	if Update(issued, false) == nil {
+		t.Fatal("Update of an issued horcrux-file went ahead")
+	}
+
+	if Apply(issued) == nil {
+		t.Error("Apply of an issued horcrux-file went ahead")
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.refresh"))
+	if err != nil || len(paths) != 0 {
+		t.Errorf("sub-updates written: %v %v", paths, err)
+	}
+}
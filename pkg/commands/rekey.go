@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+)
+
+// Rekey decrypts the payload of the horcrux-files in dir and encrypts it
+// under a new key, that gets split into n horcrux-files (m needed to reconstruct)
+// of a new set that supersedes the old one (written as out says, in dir by default),
+// without the plaintext touching disk
+func Rekey(dir string, n int, m int, weights []int, policy string, out Output) error {
+	if out.Dir == "" {
+		out.Dir = dir
+	}
+	ymls, _, err := readHorcruxes(dir, out.Compress)
+	if err != nil {
+		return err
+	}
+
+	err = ymls[0].keyed()
+	if err != nil {
+		return err
+	}
+
+	n, m, weights, policy, err = newNumbers(ymls[0], n, m, weights, policy)
+	if err != nil {
+		return err
+	}
+
+	oldkey, encfile, err := unlock(ymls)
+	if err != nil {
+		return err
+	}
+
+	defer clear(oldkey)
+	key, err := newKey()
+	if err != nil {
+		return err
+	}
+
+	defer clear(key)
+
+	yml := ymlFile{
+		Filename:   ymls[0].Filename,
+		Archive:    ymls[0].Archive,
+		Perm:       ymls[0].Perm,
+		Weights:    weights,
+		Policy:     policy,
+		Supersedes: append([]string{ymls[0].setID()}, ymls[0].Supersedes...),
+	}
+	if ymls[0].Secrets != nil {
+		yml.Secrets, err = rekeySecrets(ymls[0].Secrets, oldkey, key)
+		if err != nil {
+			return err
+		}
+
+		return writeSet(yml, key, nil, n, m, out)
+	}
+
+	newfile, digest, err := reencrypt(encfile, oldkey, ymls[0].Digest, key)
+	if err != nil {
+		return err
+	}
+
+	yml.Digest = digest
+	yml.Meta, err = reencryptMeta(ymls[0].Meta, oldkey, key)
+	if err != nil {
+		return err
+	}
+
+	return writeSet(yml, key, newfile, n, m, out)
+}
+
+// reencrypt returns encfile encrypted under key instead of oldkey, with its new digest,
+// after checking it against the old digest (if present)
+func reencrypt(encfile, oldkey []byte, olddigest string, key []byte) ([]byte, string, error) {
+	// Only a buffer of plaintext at a time, digested on its way from the old to the new encryption
+	oldstream, stream := cryptoStream(oldkey), cryptoStream(key)
+	oldmac, mac := digester(oldkey), digester(key)
+	newfile := make([]byte, len(encfile))
+	buf := make([]byte, 32*1024)
+	defer clear(buf)
+	for start := 0; start < len(encfile); start += len(buf) {
+		end := min(start+len(buf), len(encfile))
+		plain := buf[:end-start]
+		oldstream.XORKeyStream(plain, encfile[start:end])
+		oldmac.Write(plain)
+		mac.Write(plain)
+		stream.XORKeyStream(newfile[start:end], plain)
+	}
+	if olddigest != "" {
+		digest, err := hex.DecodeString(olddigest)
+		if err != nil || !hmac.Equal(digest, oldmac.Sum(nil)) {
+			return nil, "", errDigest
+		}
+	}
+	return newfile, hex.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestRekey(t *testing.T) {
+	// Longer than the buffer, so the payload is reencrypted in pieces
+	content := strings.Repeat("rekeyed in pieces\n", 5000)
+	dir := splitString(t, content, 3, 2, "")
+	old, err := readHorcrux(setFiles(t, dir, 3)[0], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Rekey(dir, 4, 2, nil, "", Output{})
+	if err != nil {
+		t.Fatalf("Rekey: %v", err)
+	}
+
+	paths := setFiles(t, dir, 4)
+	if len(paths) != 4 {
+		t.Fatalf("Rekey wrote %v, want 4 horcrux-files in %s", paths, dir)
+	}
+
+	yml, err := readHorcrux(paths[0], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if yml.Payload == old.Payload || yml.Digest == old.Digest || yml.Supersedes[0] != old.setID() {
+		t.Error("the new set doesn't have a new key")
+	}
+
+	got, err := mergeString(t, dir)
+	if err != nil || got != content {
+		t.Errorf("merge after rekey: got %d bytes (%v), want %d", len(got), err, len(content))
+	}
+}
+
+func TestRekeyTampered(t *testing.T) {
+	dir := splitString(t, "secret", 3, 2, "")
+	editHorcruxes(t, dir, func(yml *ymlFile) {
+		payload, err := base64.StdEncoding.DecodeString(yml.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		payload[len(payload)-1] ^= 1
+		yml.Payload = base64.StdEncoding.EncodeToString(payload)
+	})
+	err := Rekey(dir, 4, 2, nil, "", Output{})
+	if err != errDigest {
+		t.Errorf("Rekey of a tampered payload returned %v, want errDigest", err)
+	}
+
+	if paths := setFiles(t, dir, 4); len(paths) != 0 {
+		t.Errorf("Rekey wrote %v", paths)
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	oldkey, key := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	plain := bytes.Repeat([]byte("0123456789"), 7000)
+	var encfile bytes.Buffer
+	mac := digester(oldkey)
+	mac.Write(plain)
+	_, err := encfile.ReadFrom(cryptoReader(bytes.NewReader(plain), oldkey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	olddigest := hex.EncodeToString(mac.Sum(nil))
+	newfile, digest, err := reencrypt(encfile.Bytes(), oldkey, olddigest, key)
+	if err != nil {
+		t.Fatalf("reencrypt: %v", err)
+	}
+
+	var got bytes.Buffer
+	err = decrypt(key, newfile, digest, &got)
+	if err != nil || !bytes.Equal(got.Bytes(), plain) {
+		t.Fatalf("decrypt of the reencrypted payload: %v", err)
+	}
+
+	tampered := bytes.Clone(encfile.Bytes())
+	tampered[len(tampered)-1] ^= 1
+	_, _, err = reencrypt(tampered, oldkey, olddigest, key)
+	if err != errDigest {
+		t.Errorf("reencrypt of a tampered payload returned %v, want errDigest", err)
+	}
+}
@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Reshare splits the key reconstructed from the horcrux-files in dir anew
+// into n horcrux-files (m needed to reconstruct) of a new set that supersedes
+// the old one (written as out says, in dir by default), the encrypted payload stays the same
+func Reshare(dir string, n int, m int, weights []int, policy string, out Output) error {
+	if out.Dir == "" {
+		out.Dir = dir
+	}
+	ymls, _, err := readHorcruxes(dir, out.Compress)
+	if err != nil {
+		return err
+	}
+
+	err = ymls[0].keyed()
+	if err != nil {
+		return err
+	}
+
+	n, m, weights, policy, err = newNumbers(ymls[0], n, m, weights, policy)
+	if err != nil {
+		return err
+	}
+
+	key, encfile, err := unlock(ymls)
+	if err != nil {
+		return err
+	}
+
+	defer clear(key)
+
+	// Make sure the old set is sound before superseding it
+	writes := []func(io.Writer) error{func(writer io.Writer) error {
+		return decrypt(key, encfile, ymls[0].Digest, writer)
+	}}
+	if ymls[0].Secrets != nil {
+		_, writes, err = secretWriters(ymls[0], key, "")
+		if err != nil {
+			return err
+		}
+	}
+	// Horcrux-files from before digests get one
+	mac := digester(key)
+	for _, write := range writes {
+		err = write(mac)
+		if err != nil {
+			return errors.New(err.Error() + ", not resharing")
+		}
+	}
+	digest := ymls[0].Digest
+	if digest == "" && ymls[0].Secrets == nil {
+		digest = hex.EncodeToString(mac.Sum(nil))
+	}
+
+	yml := ymlFile{
+		Filename:   ymls[0].Filename,
+		Archive:    ymls[0].Archive,
+		Perm:       ymls[0].Perm,
+		Weights:    weights,
+		Policy:     policy,
+		Supersedes: append([]string{ymls[0].setID()}, ymls[0].Supersedes...),
+		Digest:     digest,
+		Meta:       ymls[0].Meta,
+		Secrets:    ymls[0].Secrets,
+	}
+	return writeSet(yml, key, encfile, n, m, out)
+}
+
+// newNumbers returns the number, minimum, weights and policy for a new set replacing
+// the set of yml (n and m of 0 keep the old values, m of 0 with given n or weights is all)
+func newNumbers(yml ymlFile, n int, m int, weights []int, policy string) (int, int, []int, string, error) {
+	if policy != "" || (n == 0 && m == 0 && weights == nil && yml.Policy != "") {
+		if policy == "" {
+			policy = yml.Policy
+		}
+		return 0, 0, nil, policy, nil
+	}
+
+	if weights == nil && n == 0 && yml.Weights != nil {
+		weights = yml.Weights
+		if m == 0 {
+			m = yml.Minimum
+		}
+	}
+	if weights != nil {
+		n = len(weights)
+		total := 0
+		for _, w := range weights {
+			total += w
+		}
+		if m == 0 {
+			m = total
+		}
+		if m > total {
+			return 0, 0, nil, "", fmt.Errorf("minimum %d can't be more than the number of keyparts %d", m, total)
+		}
+
+		return n, m, weights, "", nil
+	}
+
+	if m == 0 {
+		m = yml.Minimum
+		if n > 0 {
+			m = n
+		}
+	}
+	if n == 0 {
+		n = yml.Total
+		if yml.Policy != "" {
+			return 0, 0, nil, "", errors.New("the number of horcrux-files is needed to replace a policy")
+		}
+	}
+	if m > n {
+		return 0, 0, nil, "", fmt.Errorf("minimum %d can't be more than the number %d", m, n)
+	}
+
+	return n, m, nil, "", nil
+}
@@ -0,0 +1,79 @@
+package commands
+
+import "testing"
+
+func TestReshare(t *testing.T) {
+	content := "reshared"
+	dir := splitString(t, content, 3, 2, "")
+	old, err := readHorcrux(setFiles(t, dir, 3)[0], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Reshare(dir, 5, 3, nil, "", Output{})
+	if err != nil {
+		t.Fatalf("Reshare: %v", err)
+	}
+
+	// The new set is written next to the old one and supersedes it
+	paths := setFiles(t, dir, 5)
+	if len(paths) != 5 {
+		t.Fatalf("Reshare wrote %v, want 5 horcrux-files in %s", paths, dir)
+	}
+
+	yml, err := readHorcrux(paths[0], false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if yml.Minimum != 3 || yml.Set == old.Set || len(yml.Supersedes) != 1 || yml.Supersedes[0] != old.setID() {
+		t.Errorf("new set: minimum %d, set %s, supersedes %v (old set %s)", yml.Minimum, yml.Set, yml.Supersedes, old.setID())
+	}
+
+	if yml.Payload != old.Payload {
+		t.Error("the encrypted payload changed")
+	}
+
+	got, err := mergeString(t, dir)
+	if err != nil || got != content {
+		t.Errorf("merge after reshare: got %q (%v), want %q", got, err, content)
+	}
+}
+
+func TestReshareExisting(t *testing.T) {
+	dir := splitString(t, "secret", 3, 2, "")
+	old := setFiles(t, dir, 3)
+
+	// Keeping the numbers, the new set doesn't take the names of the old one
+	err := Reshare(dir, 0, 0, nil, "", Output{})
+	if err != nil {
+		t.Fatalf("Reshare: %v", err)
+	}
+
+	paths := setFiles(t, dir, 3)
+	if len(paths) != 6 {
+		t.Fatalf("Reshare left %v, want the old and the new set", paths)
+	}
+
+	for _, path := range old {
+		yml, err := readHorcrux(path, false)
+		if err != nil || yml.Supersedes != nil {
+			t.Errorf("%s replaced by the new set (%v)", path, err)
+		}
+	}
+
+	// Again, next to both
+	err = Reshare(dir, 0, 0, nil, "", Output{})
+	if err != nil {
+		t.Fatalf("second Reshare: %v", err)
+	}
+
+	if paths = setFiles(t, dir, 3); len(paths) != 9 {
+		t.Fatalf("second Reshare left %v, want three sets", paths)
+	}
+
+	got, err := mergeString(t, dir)
+	if err != nil || got != "secret" {
+		t.Errorf("merge after reshare: got %q (%v)", got, err)
+	}
+}
@@ -1,100 +1,239 @@
 package commands
 
 import (
-	"bytes"
 	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/klauspost/compress/zstd"
 	"github.com/pepa65/horcrux/pkg/shamir"
 )
 
-func Split(path string, n int, m int, compress bool, force bool) error {
-	file, err := os.Open(path)
-	if err != nil {
-		return errors.New("error opening the file")
+// Split splits the file at path into n horcrux-files (m needed to reconstruct),
+// a directory at path is packed into a tar archive (compressed with compress),
+// with mode ModeRamp or ModeDirect the file itself is shared instead of a key
+// (in ramp mode fewer than privacy horcrux-files reveal nothing about it),
+// path "-" is standard input, name (if not empty) is stored as the filename,
+// the metadata of a file is recorded as capture says (only its permissions without key),
+// the horcrux-files are written as out says
+func Split(path string, name string, n int, m int, weights []int, policy string, mode string, privacy int, capture Capture, out Output) error {
+	if name != "" && !plainName(name) {
+		return fmt.Errorf("bad name '%s', it should be a filename without directories", name)
 	}
 
-	info, _ := file.Stat()
-	towrite := info.Size()
-	filename := info.Name()
-
-	key := make([]byte, 32)
-	_, err = rand.Read(key)
-	if err != nil {
-		return errors.New("error generating a random key")
-	}
+	var file io.ReadCloser
+	var meta *metadata
+	yml := ymlFile{Filename: name, Weights: weights, Policy: policy, Mode: mode, Privacy: privacy}
+	info, err := os.Stat(path)
+	if path == "-" {
+		if name == "" {
+			return errors.New("a name is needed for the file from standard input")
+		}
 
-	encReader := cryptoReader(file, key)
-	var b64full bytes.Buffer
-	if n > m {
-		b64enc := base64.NewEncoder(base64.StdEncoding, &b64full)
-		_, err := io.Copy(b64enc, encReader)
+		file = io.NopCloser(os.Stdin)
+	} else if err != nil {
+		return errors.New("error opening the file")
+	} else if info.IsDir() {
+		abs, err := filepath.Abs(path)
 		if err != nil {
 			return err
 		}
-		b64enc.Close()
-	}
-	payloadfull := b64full.String()
-	keyparts, err := shamir.Split(key, n, m)
-	if err != nil {
-		return errors.New("error splitting the key")
-	}
-
-	partnames := make([]string, 0, n)
-	timestamp := time.Now().Unix()
-	for i, k := range keyparts {
-		payload := payloadfull
-		partname := fmt.Sprintf("%s_horcrux%dof%d.yml", filename, i+1, n)
-		if m == n {
-			size := towrite / int64(n-i)
-			towrite -= size
-			part := make([]byte, size)
-			_, err := io.ReadFull(encReader, part)
-			if err != nil && err != io.EOF {
-				return err
-			}
-			payload = base64.StdEncoding.EncodeToString(part)
+
+		if name == "" {
+			yml.Filename = filepath.Base(abs)
 		}
-		yaml := []byte(fmt.Sprintf("filename: %q\ntimestamp: %d\nindex: %d\ntotal: %d\nminimum: %d\nkeypart: %x\npayload: %s\n", filename, timestamp, i+1, n, m, k, payload))
-		if compress {
-			partname = fmt.Sprintf("%s_%dof%d.horcrux", filename, i+1, n)
+		yml.Archive = archiveTar
+		if out.Compress {
+			yml.Archive = archiveTarZstd
 		}
-		if !force {
-			_, err := os.Stat(partname)
-			if err == nil {
-				return fmt.Errorf("file '%s' already exists", partname)
-			}
+		file = archiveReader(path, out.Compress)
+	} else {
+		if name == "" {
+			yml.Filename = info.Name()
 		}
-		partfile, err := os.Create(partname)
+		file, err = os.Open(path)
 		if err != nil {
-    	return err
+			return errors.New("error opening the file")
 		}
-		defer partfile.Close()
-		if compress {
-			zwriter, err := zstd.NewWriter(partfile, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
-			if err != nil {
-  	  	return err
-			}
-			defer zwriter.Close()
-			_, err = zwriter.Write(yaml)
-			if err != nil {
-  	  	return err
-			}
+
+		if mode != "" {
+			yml.Perm = recordPerm(info.Mode())
 		} else {
-			_, err = partfile.Write(yaml)
+			meta, err = captureMeta(path, info, capture)
 			if err != nil {
+				file.Close()
 				return err
 			}
 		}
-		partnames[i] = partname
 	}
+	defer file.Close()
+
+	if mode != "" {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+
+		yml.Weights, yml.Policy = nil, ""
+		return writeSet(yml, nil, data, n, m, out)
+	}
+
+	key, err := newKey()
+	if err != nil {
+		return err
+	}
+
+	// The digest of the plaintext is keyed, so it reveals nothing without the key
+	mac := digester(key)
+	encfile, err := io.ReadAll(cryptoReader(io.TeeReader(file, mac), key))
+	if err != nil {
+		return err
+	}
+
+	yml.Digest = hex.EncodeToString(mac.Sum(nil))
+	if meta != nil {
+		yml.Meta, err = encryptMeta(meta, key)
+		if err != nil {
+			return err
+		}
+	}
+	return writeSet(yml, key, encfile, n, m, out)
+}
+
+// writeSet splits key into a new set of n horcrux-files (m needed to reconstruct),
+// carrying encfile as payload and the other attributes of yml
+// (with yml.Weights, the n horcrux-files carry that many keyparts, m of them needed,
+// with yml.Policy, there is a horcrux-file for each holder in the policy,
+// in ramp and direct mode there is no key and encfile is the file itself),
+// the horcrux-files are written as out says
+func writeSet(yml ymlFile, key, encfile []byte, n int, m int, out Output) error {
+	set, err := newSet()
+	if err != nil {
+		return err
+	}
+
+	yml.Set = set
+	yml.Timestamp = time.Now().Unix()
+	var parts []ymlFile
+	switch {
+	case yml.Mode == ModeRamp:
+		parts, err = rampParts(yml, encfile, n, m)
+	case yml.Mode == ModeDirect:
+		parts, err = directParts(yml, encfile, n, m)
+	case yml.Mode != "":
+		err = fmt.Errorf("unknown mode '%s'", yml.Mode)
+	case yml.Policy != "":
+		parts, err = policyParts(yml, key, encfile)
+	default:
+		parts, err = thresholdParts(yml, key, encfile, n, m)
+	}
+	if err != nil {
+		return err
+	}
+
+	partnames, err := out.paths(parts)
+	if err != nil {
+		return err
+	}
+
+	err = writeHorcruxes(partnames, parts, out.perm(), out.Compress, out.Force)
+	if err != nil {
+		return err
+	}
+
 	fmt.Printf("Written: %s\n", strings.Join(partnames, " "))
 	return nil
 }
+
+// thresholdParts returns the n horcrux-files of yml for a threshold of m
+func thresholdParts(yml ymlFile, key, encfile []byte, n int, m int) ([]ymlFile, error) {
+	total := n
+	if yml.Weights != nil {
+		if len(yml.Weights) != n {
+			return nil, fmt.Errorf("%d weights given for %d horcrux-files", len(yml.Weights), n)
+		}
+
+		total = 0
+		for _, w := range yml.Weights {
+			total += w
+		}
+	}
+	payloads := make([]string, n)
+	if total > m || yml.Weights != nil || yml.Secrets != nil {
+		// m < n: All files have the same payload
+		b64full := base64.StdEncoding.EncodeToString(encfile)
+		for i := range payloads {
+			payloads[i] = b64full
+		}
+	} else {
+		// m == n: Every file has its own part of the payload
+		towrite := len(encfile)
+		for i := range payloads {
+			size := towrite / (n - i)
+			payloads[i] = base64.StdEncoding.EncodeToString(encfile[:size])
+			encfile, towrite = encfile[size:], towrite-size
+		}
+	}
+	yml.Total = total
+	yml.Minimum = m
+	var keyparts [][]byte
+	var err error
+	if total > 255 {
+		// Beyond 255 keyparts the key is split in GF(2^16)
+		yml.Field = 16
+		keyparts, err = shamir.Split16(key, total, m)
+	} else {
+		keyparts, err = shamir.Split(key, total, m)
+	}
+	if err != nil {
+		return nil, errors.New("error splitting the key")
+	}
+
+	// Record the x coordinates of all keyparts, so lost ones can be reissued
+	if yml.Field == 0 {
+		coords := make([]byte, total)
+		for i, k := range keyparts {
+			coords[i] = k[len(k)-1]
+		}
+		yml.Coords = hex.EncodeToString(coords)
+	}
+	parts := make([]ymlFile, n)
+	start := 0
+	for i := range parts {
+		yml.Index = start + 1
+		w := yml.weight()
+		yml.setPoints(keyparts[start : start+w])
+		yml.Payload = payloads[i]
+		parts[i] = yml
+		start += w
+	}
+	return parts, nil
+}
+
+// newKey returns a random 256 bit encryption key
+func newKey() ([]byte, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, errors.New("error generating a random key")
+	}
+
+	return key, nil
+}
+
+// newSet returns a random identifier for a new set of horcrux-files
+func newSet() (string, error) {
+	set := make([]byte, 8)
+	_, err := rand.Read(set)
+	if err != nil {
+		return "", errors.New("error generating a random set identifier")
+	}
+
+	return hex.EncodeToString(set), nil
+}
@@ -0,0 +1,124 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitStdin(t *testing.T) {
+	content := "piped in"
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = w.WriteString(content)
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+	dir := t.TempDir()
+	err = Split("-", "", 2, 2, nil, "", "", 0, Capture{}, Output{Dir: dir})
+	if err == nil {
+		t.Fatal("Split of standard input without a name")
+	}
+
+	err = Split("-", "../secret.txt", 2, 2, nil, "", "", 0, Capture{}, Output{Dir: dir})
+	if err == nil {
+		t.Fatal("Split accepted a name with directories")
+	}
+
+	err = Split("-", "secret.txt", 2, 2, nil, "", "", 0, Capture{}, Output{Dir: dir})
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+
+	got, err := mergeString(t, dir)
+	if err != nil || got != content {
+		t.Errorf("merge: got %q (%v), want %q", got, err, content)
+	}
+}
+
+func TestSplitWeights(t *testing.T) {
+	content := "weighted"
+	path := filepath.Join(t.TempDir(), "secret.txt")
+	writeString(t, path, content)
+	dir := t.TempDir()
+	err := Split(path, "", 3, 3, []int{2, 1, 1}, "", "", 0, Capture{}, Output{Dir: dir})
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+
+	// The first carries keyparts 1 and 2, the others 3 and 4
+	names := dirNames(t, dir)
+	want := []string{"secret.txt_horcrux1of4.yml", "secret.txt_horcrux3of4.yml", "secret.txt_horcrux4of4.yml"}
+	if len(names) != len(want) || names[0] != want[0] || names[1] != want[1] || names[2] != want[2] {
+		t.Fatalf("Split wrote %v, want %v", names, want)
+	}
+
+	err = os.Remove(filepath.Join(dir, want[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := mergeString(t, dir)
+	if err != nil || got != content {
+		t.Errorf("merge of the heavy and a light horcrux-file: got %q (%v), want %q", got, err, content)
+	}
+
+	err = os.Remove(filepath.Join(dir, want[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err = mergeString(t, dir); err == nil {
+		t.Errorf("a single light horcrux-file merged to %q", got)
+	}
+}
+
+func TestSplitWeights16(t *testing.T) {
+	content := "weighted beyond 255 keyparts"
+	path := filepath.Join(t.TempDir(), "secret.txt")
+	writeString(t, path, content)
+	parts := t.TempDir()
+	err := Split(path, "", 3, 250, []int{200, 100, 50}, "", "", 0, Capture{}, Output{Dir: parts})
+	if err != nil {
+		t.Fatalf("Split: %v", err)
+	}
+
+	paths, err := filepath.Glob(filepath.Join(parts, "*.yml"))
+	if err != nil || len(paths) != 3 {
+		t.Fatalf("Split wrote %v (%v)", paths, err)
+	}
+
+	yml, err := readHorcrux(paths[0], false)
+	if err != nil || yml.Field != 16 || yml.Total != 350 {
+		t.Fatalf("field %d, total %d (%v), want 16 and 350", yml.Field, yml.Total, err)
+	}
+
+	// The first and the last carry 250 keyparts, the last two only 150
+	err = os.Remove(paths[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := mergeString(t, parts)
+	if err != nil || got != content {
+		t.Errorf("merge of 250 keyparts: got %q (%v), want %q", got, err, content)
+	}
+
+	err = os.Remove(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = mergeString(t, parts)
+	if err == nil || got != "" {
+		t.Errorf("merge of 50 keyparts: got %q (%v)", got, err)
+	}
+}
@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pepa65/horcrux/pkg/shamir"
+	"gopkg.in/yaml.v3"
+)
+
+// keyMaterial holds the keyparts of a horcrux-file, it is what gets sub-shared
+type keyMaterial struct {
+	Keypart  string            `yaml:"keypart,omitempty"`
+	Keyparts []string          `yaml:"keyparts,omitempty"`
+	Branches map[string]string `yaml:"branches,omitempty"`
+}
+
+// Subshare splits the keyparts of horcrux-file path among n delegates
+// (m needed to rebuild them), without involving the other holders,
+// the sub-shares are written next to it
+func Subshare(path string, n int, m int, force bool) error {
+	compress := strings.HasSuffix(path, ".horcrux")
+	yml, err := readHorcrux(path, compress)
+	if err != nil {
+		return err
+	}
+
+	err = yml.keyed()
+	if err != nil {
+		return err
+	}
+
+	if yml.Sub != nil {
+		return errors.New("this is already a sub-share, only whole horcrux-files can be sub-shared")
+	}
+
+	secret, err := yaml.Marshal(keyMaterial{yml.Keypart, yml.Keyparts, yml.Branches})
+	if err != nil {
+		return err
+	}
+
+	subparts, err := shamir.Split(secret, n, m)
+	clear(secret)
+	if err != nil {
+		return errors.New("error splitting the keyparts")
+	}
+
+	set, err := newSet()
+	if err != nil {
+		return err
+	}
+
+	yml.Keypart, yml.Keyparts, yml.Branches = "", nil, nil
+	ext := ".yml"
+	if compress {
+		ext = ".horcrux"
+	}
+	base := strings.TrimSuffix(partName(yml, compress), ext)
+	partnames := make([]string, n)
+	parts := make([]ymlFile, n)
+	for i, subpart := range subparts {
+		yml.Sub = &subShare{Set: set, Index: i + 1, Total: n, Minimum: m, Keypart: hex.EncodeToString(subpart)}
+		partnames[i] = filepath.Join(filepath.Dir(path), fmt.Sprintf("%s_sub%dof%d%s", base, i+1, n, ext))
+		parts[i] = yml
+	}
+	err = writeHorcruxes(partnames, parts, defaultPerm, compress, force)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Written: %s\n", strings.Join(partnames, " "))
+	return nil
+}
+
+// resolveSubshares replaces sub-shares by the horcrux-files they rebuild,
+// sub-shares of a horcrux-file that is present or that are too few are skipped
+func resolveSubshares(ymls []ymlFile, names []string) ([]ymlFile, []string, error) {
+	present := map[int]bool{}
+	groups := map[string][]int{}
+	order := []string{}
+	for i, yml := range ymls {
+		if yml.Sub == nil {
+			present[yml.Index] = true
+			continue
+		}
+
+		id := fmt.Sprintf("%d/%s", yml.Index, yml.Sub.Set)
+		if groups[id] == nil {
+			order = append(order, id)
+		}
+		groups[id] = append(groups[id], i)
+	}
+	if len(groups) == 0 {
+		return ymls, names, nil
+	}
+
+	var outs []ymlFile
+	var outnames []string
+	for i, yml := range ymls {
+		if yml.Sub == nil {
+			outs = append(outs, yml)
+			outnames = append(outnames, names[i])
+		}
+	}
+	for _, id := range order {
+		group := groups[id]
+		yml := ymls[group[0]]
+		if present[yml.Index] {
+			fmt.Printf("Skipping sub-shares of horcrux-file %d, it is present itself\n", yml.Index)
+			continue
+		}
+
+		if len(group) < yml.Sub.Minimum {
+			fmt.Printf("Skipping sub-shares of horcrux-file %d, %d are needed, only %d here\n", yml.Index, yml.Sub.Minimum, len(group))
+			continue
+		}
+
+		subparts := make([][]byte, len(group))
+		subnames := make([]string, len(group))
+		for j, i := range group {
+			var err error
+			subparts[j], err = hex.DecodeString(ymls[i].Sub.Keypart)
+			if err != nil {
+				return nil, nil, errors.New("bad keypart in " + names[i])
+			}
+
+			subnames[j] = names[i]
+		}
+		secret, err := shamir.Combine(subparts)
+		if err != nil {
+			return nil, nil, fmt.Errorf("problem recombining the sub-shares of horcrux-file %d", yml.Index)
+		}
+
+		var km keyMaterial
+		err = yaml.Unmarshal(secret, &km)
+		clear(secret)
+		if err != nil {
+			return nil, nil, fmt.Errorf("sub-shares of horcrux-file %d are mismatched or damaged", yml.Index)
+		}
+
+		yml.Keypart, yml.Keyparts, yml.Branches, yml.Sub = km.Keypart, km.Keyparts, km.Branches, nil
+		present[yml.Index] = true
+		outs = append(outs, yml)
+		outnames = append(outnames, strings.Join(subnames, "+"))
+	}
+	return outs, outnames, nil
+}
@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSubshare(t *testing.T) {
+	content := "delegated"
+	dir := splitString(t, content, 3, 2, "")
+	paths := setFiles(t, dir, 3)
+	err := Subshare(paths[0], 3, 2, false)
+	if err != nil {
+		t.Fatalf("Subshare: %v", err)
+	}
+
+	subs, err := filepath.Glob(filepath.Join(dir, "*_sub*of3.yml"))
+	if err != nil || len(subs) != 3 {
+		t.Fatalf("Subshare wrote %v (%v), want 3 sub-shares in %s", subs, err, dir)
+	}
+
+	if Subshare(subs[0], 2, 2, false) == nil {
+		t.Error("a sub-share was sub-shared")
+	}
+
+	// The original present as well
+	got, err := mergeString(t, dir)
+	if err != nil || got != content {
+		t.Errorf("merge with the original: got %q (%v), want %q", got, err, content)
+	}
+
+	err = os.Remove(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Remove(paths[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two sub-shares take the place of the original
+	err = os.Remove(subs[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = mergeString(t, dir)
+	if err != nil || got != content {
+		t.Errorf("merge with sub-shares: got %q (%v), want %q", got, err, content)
+	}
+
+	// One sub-share is not enough
+	err = os.Remove(subs[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err = mergeString(t, dir)
+	if err == nil {
+		t.Errorf("merge with one sub-share of two: got %q", got)
+	}
+}
+
+func TestResolveSubsharesSets(t *testing.T) {
+	dir := splitString(t, "secret", 2, 2, "")
+	path := setFiles(t, dir, 2)[0]
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same horcrux-file sub-shared twice
+	again := filepath.Join(t.TempDir(), filepath.Base(path))
+	err = os.WriteFile(again, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ymls []ymlFile
+	var names []string
+	for _, path := range []string{path, again} {
+		err := Subshare(path, 2, 2, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		name := strings.TrimSuffix(path, ".yml") + "_sub1of2.yml"
+		yml, err := readHorcrux(name, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ymls, names = append(ymls, yml), append(names, name)
+	}
+	// Sub-shares of different rounds don't combine
+	outs, _, err := resolveSubshares(ymls, names)
+	if err != nil || len(outs) != 0 {
+		t.Errorf("sub-shares of different rounds resolved to %d horcrux-files (%v)", len(outs), err)
+	}
+}
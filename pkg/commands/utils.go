@@ -4,21 +4,123 @@ import (
 	"bufio"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
 	"fmt"
+	"hash"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
 )
 
 func cryptoReader(reader io.Reader, key []byte) io.Reader {
+	return cipher.StreamReader{S: cryptoStream(key), R: reader}
+}
+
+// cryptoStream returns the keystream that encrypts (and decrypts) a payload under key
+func cryptoStream(key []byte) cipher.Stream {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		panic(err)
 	}
 
 	var iv [aes.BlockSize]byte
-	stream := cipher.NewCTR(block, iv[:])
-	return cipher.StreamReader{S: stream, R: reader}
+	return cipher.NewCTR(block, iv[:])
+}
+
+// digester returns the keyed SHA-256 hash that binds the plaintext to the key,
+// under a key derived from it (so the encryption key is never used for anything else)
+func digester(key []byte) hash.Hash {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("horcrux digest"))
+	return hmac.New(sha256.New, mac.Sum(nil))
+}
+
+// partName returns the name of horcrux-file yml, those of a set that supersedes
+// another carry its set identifier, so they don't collide with the old names
+func partName(yml ymlFile, compress bool) string {
+	marker := ""
+	if yml.Supersedes != nil {
+		marker = "_" + yml.Set
+	}
+	if compress {
+		return fmt.Sprintf("%s_%dof%d%s.horcrux", yml.Filename, yml.Index, yml.Total, marker)
+	}
+	return fmt.Sprintf("%s_horcrux%dof%d%s.yml", yml.Filename, yml.Index, yml.Total, marker)
+}
+
+// writeHorcrux writes yml to horcrux-file partname
+func writeHorcrux(partname string, yml ymlFile, compress bool, force bool) error {
+	return writeHorcruxes([]string{partname}, []ymlFile{yml}, defaultPerm, compress, force)
+}
+
+// writeHorcruxes writes the horcrux-files parts to partnames with permissions perm, all or nothing
+func writeHorcruxes(partnames []string, parts []ymlFile, perm os.FileMode, compress bool, force bool) error {
+	if !force {
+		for _, partname := range partnames {
+			_, err := os.Stat(partname)
+			if err == nil {
+				return fmt.Errorf("file '%s' already exists", partname)
+			}
+		}
+	}
+	temps := make([]string, 0, len(parts))
+	for i, part := range parts {
+		temp, err := stage(partnames[i], perm, func(writer io.Writer) error {
+			return encodeHorcrux(writer, part, compress)
+		})
+		if err != nil {
+			pending.discard(temps...)
+			return err
+		}
+
+		temps = append(temps, temp)
+	}
+	return commit(temps, partnames)
+}
+
+// encodeHorcrux writes yml to writer as a horcrux-file
+func encodeHorcrux(writer io.Writer, yml ymlFile, compress bool) error {
+	data, err := yaml.Marshal(yml)
+	if err != nil {
+		return err
+	}
+
+	if compress {
+		zwriter, err := zstd.NewWriter(writer, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+		if err != nil {
+			return err
+		}
+
+		_, err = zwriter.Write(data)
+		if err != nil {
+			zwriter.Close()
+			return err
+		}
+
+		return zwriter.Close()
+	}
+	_, err = writer.Write(data)
+	return err
+}
+
+// xCoord returns the x coordinate of the horcrux-file with the given index
+// as recorded in coords (0 when unknown)
+func xCoord(coords []byte, index int) uint8 {
+	if index < 1 || index > len(coords) {
+		return 0
+	}
+	return coords[index-1]
+}
+
+// plainName tells whether name is a plain filename, without directories
+func plainName(name string) bool {
+	return name == filepath.Base(name) && filepath.IsLocal(name) && !strings.Contains(name, `\`)
 }
 
 func fileExists(filename string) bool {
@@ -29,6 +131,11 @@ func fileExists(filename string) bool {
 	return !info.IsDir()
 }
 
+// terminal tells whether standard input is a terminal, so prompt can be used
+func terminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
 func prompt(message string, args ...interface{}) string {
 	reader := bufio.NewReader(os.Stdin)
 	fmt.Printf(message, args...)
@@ -0,0 +1,249 @@
+package shamir
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// The bulk functions share and reconstruct large data (megabytes), they
+// produce and take the same shares as Split and Combine. Everything that only
+// depends on the x coordinates is computed once per share set, the data is
+// processed with multiply-accumulate over multiplication tables, in chunks
+// that are handled in parallel.
+
+// bulkChunk is the number of bytes of the data that is processed at once
+const bulkChunk = 64 * 1024
+
+// bulkBatch is the number of bytes of the data that random coefficients are
+// drawn for at once, fixed so the shares only depend on the randomness
+const bulkBatch = 16 * bulkChunk
+
+// mulTable multiplies by a constant in GF(2^8) through two 16 entry tables
+// for the low and high nibble, both fit in a single cache line, so looking up
+// (secret) data bytes doesn't leak through which cache lines get loaded
+type mulTable struct {
+	low, high [16]uint8
+}
+
+// newMulTable returns the multiplication table for c
+func newMulTable(c uint8) *mulTable {
+	t := &mulTable{}
+	for n := uint8(0); n < 16; n++ {
+		t.low[n] = mult(c, n)
+		t.high[n] = mult(c, n<<4)
+	}
+	return t
+}
+
+// mulAdd adds src multiplied by the constant of the table to dst
+func (t *mulTable) mulAdd(dst, src []byte) {
+	dst = dst[:len(src)]
+	for i, s := range src {
+		dst[i] ^= t.low[s&15] ^ t.high[s>>4]
+	}
+}
+
+// mulThenAdd multiplies dst by the constant of the table and adds src
+// (a step of Horner's method)
+func (t *mulTable) mulThenAdd(dst, src []byte) {
+	dst = dst[:len(src)]
+	for i, s := range src {
+		d := dst[i]
+		dst[i] = t.low[d&15] ^ t.high[d>>4] ^ s
+	}
+}
+
+// parallel calls fn for consecutive chunks of 0..length in parallel
+func parallel(length int, fn func(start, end int)) {
+	if length <= bulkChunk {
+		fn(0, length)
+		return
+	}
+
+	var wg sync.WaitGroup
+	chunks := make(chan int)
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range chunks {
+				fn(start, min(start+bulkChunk, length))
+			}
+		}()
+	}
+	for start := 0; start < length; start += bulkChunk {
+		chunks <- start
+	}
+	close(chunks)
+	wg.Wait()
+}
+
+// SplitBulk is Split for large data, drawing the x coordinates and the
+// coefficients from crypto/rand.
+func SplitBulk(data []byte, number, minimum int) ([][]byte, error) {
+	return SplitBulkReader(rand.Reader, data, number, minimum)
+}
+
+// SplitBulkReader is SplitBulk drawing the x coordinates and the coefficients
+// from random (see SplitReader). The shares are in the format of Split, but
+// the randomness is used in a different order, so they differ from those of
+// SplitReader with the same source.
+func SplitBulkReader(random io.Reader, data []byte, number, minimum int) ([][]byte, error) {
+	if number < minimum {
+		return nil, fmt.Errorf("number cannot be less than minimum")
+	}
+
+	if number > 255 {
+		return nil, fmt.Errorf("number cannot exceed 255")
+	}
+
+	if minimum < 1 {
+		return nil, fmt.Errorf("minimum must be at least 1")
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("cannot split empty data")
+	}
+
+	xCoordinates, err := randomCoordinates(random, number, 255)
+	if err != nil {
+		return nil, err
+	}
+
+	length := len(data)
+	out := make([][]byte, number)
+	tables := make([]*mulTable, number)
+	for i := range out {
+		out[i] = make([]byte, length+1)
+		out[i][length] = uint8(xCoordinates[i])
+		tables[i] = newMulTable(uint8(xCoordinates[i]))
+	}
+
+	// The random coefficients are drawn in order, a batch of chunks at a time,
+	// the coefficient of degree j for data byte k at coeffs[j-1][k]
+	degree := minimum - 1
+	coeffs := make([][]byte, degree)
+	for j := range coeffs {
+		coeffs[j] = make([]byte, min(bulkBatch, length))
+	}
+	for offset := 0; offset < length; offset += bulkBatch {
+		size := min(bulkBatch, length-offset)
+		for j := range coeffs {
+			if _, err := io.ReadFull(random, coeffs[j][:size]); err != nil {
+				return nil, err
+			}
+		}
+
+		parallel(size, func(start, end int) {
+			// Horner's method, for every share at once
+			for i, share := range out {
+				y := share[offset+start : offset+end]
+				if degree == 0 {
+					copy(y, data[offset+start:offset+end])
+					continue
+				}
+
+				copy(y, coeffs[degree-1][start:end])
+				for j := degree - 1; j >= 0; j-- {
+					src := data[offset+start : offset+end]
+					if j > 0 {
+						src = coeffs[j-1][start:end]
+					}
+					tables[i].mulThenAdd(y, src)
+				}
+			}
+		})
+	}
+	return out, nil
+}
+
+// Combiner reconstructs data from shares with a fixed set of x coordinates,
+// the Lagrange basis coefficients are computed once, in NewCombiner.
+type Combiner struct {
+	tables []*mulTable
+}
+
+// NewCombiner returns a Combiner for shares with the given x coordinates.
+func NewCombiner(xCoordinates []uint8) (*Combiner, error) {
+	if len(xCoordinates) == 0 {
+		return nil, fmt.Errorf("no x coordinates given")
+	}
+
+	checkMap := map[uint8]bool{}
+	for _, x := range xCoordinates {
+		if x == 0 || checkMap[x] {
+			return nil, fmt.Errorf("x coordinates must be unique and not zero")
+		}
+		checkMap[x] = true
+	}
+
+	c := &Combiner{}
+	for i, xi := range xCoordinates {
+		// The basis polynomial of share i at 0
+		basis := uint8(1)
+		for j, xj := range xCoordinates {
+			if i != j {
+				basis = mult(basis, div(xj, add(xi, xj)))
+			}
+		}
+		c.tables = append(c.tables, newMulTable(basis))
+	}
+	return c, nil
+}
+
+// Reconstruct writes the data into dst from the y values of the shares
+// (without the x coordinate tag), in the order of the x coordinates
+// of the Combiner. All y values must have the length of dst.
+func (c *Combiner) Reconstruct(dst []byte, ys [][]byte) error {
+	if len(ys) != len(c.tables) {
+		return fmt.Errorf("%d shares given for %d x coordinates", len(ys), len(c.tables))
+	}
+
+	for _, y := range ys {
+		if len(y) != len(dst) {
+			return fmt.Errorf("all shares must be the length of the data")
+		}
+	}
+
+	parallel(len(dst), func(start, end int) {
+		clear(dst[start:end])
+		for i, t := range c.tables {
+			t.mulAdd(dst[start:end], ys[i][start:end])
+		}
+	})
+	return nil
+}
+
+// CombineBulk is Combine for large data: it reconstructs the data from
+// shares made by Split or SplitBulk.
+func CombineBulk(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("no shares to combine")
+	}
+
+	shareLen := len(shares[0])
+	if shareLen < 2 {
+		return nil, fmt.Errorf("shares must be at least two bytes")
+	}
+
+	xCoordinates := make([]uint8, len(shares))
+	ys := make([][]byte, len(shares))
+	for i, share := range shares {
+		if len(share) != shareLen {
+			return nil, fmt.Errorf("all shares must be the same length")
+		}
+
+		xCoordinates[i] = share[shareLen-1]
+		ys[i] = share[:shareLen-1]
+	}
+	c, err := NewCombiner(xCoordinates)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, shareLen-1)
+	return data, c.Reconstruct(data, ys)
+}
@@ -0,0 +1,150 @@
+package shamir
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+// Element is an element of GF(2^8) (modulo x^8 + x^4 + x^3 + x + 1), the field
+// Split and Combine work in. All arithmetic is constant-time.
+type Element uint8
+
+// Add returns a + b, which is also a - b (the field has characteristic 2).
+func (a Element) Add(b Element) Element {
+	return Element(add(uint8(a), uint8(b)))
+}
+
+// Mul returns a * b.
+func (a Element) Mul(b Element) Element {
+	return Element(mult(uint8(a), uint8(b)))
+}
+
+// Div returns a / b, it panics when b is zero.
+func (a Element) Div(b Element) Element {
+	return Element(div(uint8(a), uint8(b)))
+}
+
+// Inv returns the multiplicative inverse of a, it panics when a is zero.
+func (a Element) Inv() Element {
+	if a == 0 {
+		panic("inverse of zero")
+	}
+
+	return Element(inverse(uint8(a)))
+}
+
+// Polynomial is a polynomial over GF(2^8), with its coefficients
+// from the lowest degree (the intercept) up.
+type Polynomial []Element
+
+// NewPolynomial returns a polynomial of the given degree with the given
+// intercept and the other coefficients drawn from random (crypto/rand when nil).
+func NewPolynomial(random io.Reader, intercept Element, degree int) (Polynomial, error) {
+	if degree < 0 || degree > 254 {
+		return nil, fmt.Errorf("degree must be between 0 and 254")
+	}
+
+	if random == nil {
+		random = rand.Reader
+	}
+	p, err := makePolynomial(random, uint8(intercept), uint8(degree))
+	if err != nil {
+		return nil, err
+	}
+
+	poly := make(Polynomial, len(p.coefficients))
+	for i, c := range p.coefficients {
+		poly[i] = Element(c)
+	}
+	return poly, nil
+}
+
+// Evaluate returns the value of the polynomial at x.
+func (p Polynomial) Evaluate(x Element) Element {
+	var out Element
+	for i := len(p) - 1; i >= 0; i-- {
+		out = out.Mul(x).Add(p[i])
+	}
+	return out
+}
+
+// Point is a point (X, Y) on a polynomial over GF(2^8).
+type Point struct {
+	X, Y Element
+}
+
+// Interpolate returns the value at x of the polynomial of the lowest degree
+// through the points (at 0 that is the secret when the points are shares).
+func Interpolate(points []Point, x Element) (Element, error) {
+	xs := make([]uint8, len(points))
+	ys := make([]uint8, len(points))
+	checkMap := map[Element]bool{}
+	for i, point := range points {
+		if checkMap[point.X] {
+			return 0, fmt.Errorf("duplicate x coordinate %d", point.X)
+		}
+		checkMap[point.X] = true
+		xs[i], ys[i] = uint8(point.X), uint8(point.Y)
+	}
+	return Element(interpolatePolynomial(xs, ys, uint8(x))), nil
+}
+
+// Share is a share of a secret: the values Y of the polynomials of all bytes
+// of the secret at X. The shares of Split are the same, in the form of Bytes.
+type Share struct {
+	X Element
+	Y []byte
+}
+
+// Bytes returns the share in the form of Split: Y with X as a trailing byte.
+func (s Share) Bytes() []byte {
+	return append(append(make([]byte, 0, len(s.Y)+1), s.Y...), byte(s.X))
+}
+
+// ParseShare returns the Share of a share in the form of Split.
+func ParseShare(b []byte) (Share, error) {
+	if len(b) < 2 {
+		return Share{}, fmt.Errorf("shares must be at least two bytes")
+	}
+
+	if b[len(b)-1] == 0 {
+		return Share{}, fmt.Errorf("x coordinate cannot be zero")
+	}
+
+	return Share{X: Element(b[len(b)-1]), Y: append([]byte(nil), b[:len(b)-1]...)}, nil
+}
+
+// SplitShares is SplitReader returning Shares (random is crypto/rand when nil).
+func SplitShares(random io.Reader, secret []byte, number, minimum int) ([]Share, error) {
+	if random == nil {
+		random = rand.Reader
+	}
+	parts, err := SplitReader(random, secret, number, minimum)
+	if err != nil {
+		return nil, err
+	}
+
+	shares := make([]Share, len(parts))
+	for i, part := range parts {
+		shares[i] = Share{X: Element(part[len(part)-1]), Y: part[:len(part)-1]}
+	}
+	return shares, nil
+}
+
+// CombineShares is Combine for Shares.
+func CombineShares(shares []Share) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, fmt.Errorf("no shares to combine")
+	}
+
+	parts := make([][]byte, len(shares))
+	for i, share := range shares {
+		if share.X == 0 {
+			return nil, fmt.Errorf("x coordinate cannot be zero")
+		}
+
+		parts[i] = share.Bytes()
+	}
+	return Combine(parts)
+}
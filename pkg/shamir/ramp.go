@@ -0,0 +1,160 @@
+package shamir
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+)
+
+// SplitRamp splits data directly into a `number` number of shares,
+// `minimum` of which are required to reconstruct the data, while fewer
+// than `privacy` of them reveal nothing about it (between those thresholds
+// shares reveal partial information). Each polynomial of degree minimum-1
+// carries minimum-privacy+1 bytes of data in its highest coefficients,
+// and random bytes in the others, so the shares are about
+// len(data)/(minimum-privacy+1) bytes (plus the one byte tag).
+// The data is padded with zeroes to a multiple of minimum-privacy+1 bytes.
+func SplitRamp(data []byte, number, minimum, privacy int) ([][]byte, error) {
+	return SplitRampReader(rand.Reader, data, number, minimum, privacy)
+}
+
+// SplitRampReader is SplitRamp drawing the x coordinates and the random
+// coefficients from random instead of crypto/rand (see SplitReader).
+func SplitRampReader(random io.Reader, data []byte, number, minimum, privacy int) ([][]byte, error) {
+	if number < minimum {
+		return nil, fmt.Errorf("number cannot be less than minimum")
+	}
+
+	if number > 255 {
+		return nil, fmt.Errorf("number cannot exceed 255")
+	}
+
+	if privacy < 1 || privacy > minimum {
+		return nil, fmt.Errorf("privacy must be between 1 and minimum")
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("cannot split empty data")
+	}
+
+	hidden, size := privacy-1, minimum-privacy+1
+	blocks := (len(data) + size - 1) / size
+
+	// Generate random list of x coordinates
+	xCoordinates, err := randomCoordinates(random, number, 255)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([][]byte, number)
+	for idx := range out {
+		out[idx] = make([]byte, blocks+1)
+		out[idx][blocks] = uint8(xCoordinates[idx])
+	}
+
+	p := polynomial{coefficients: make([]byte, minimum)}
+	for block := 0; block < blocks; block++ {
+		if _, err := io.ReadFull(random, p.coefficients[:hidden]); err != nil {
+			return nil, err
+		}
+
+		// The bytes past the end of the data stay zero
+		clear(p.coefficients[hidden:])
+		copy(p.coefficients[hidden:], data[min(block*size, len(data)):min((block+1)*size, len(data))])
+		for i := 0; i < number; i++ {
+			out[i][block] = p.evaluate(out[i][blocks])
+		}
+	}
+	return out, nil
+}
+
+// CombineRamp is used to reverse a SplitRamp and reconstruct the (padded) data
+// once a `minimum` number of shares are available.
+func CombineRamp(shares [][]byte, minimum, privacy int) ([]byte, error) {
+	if privacy < 1 || privacy > minimum {
+		return nil, fmt.Errorf("privacy must be between 1 and minimum")
+	}
+
+	if len(shares) < minimum {
+		return nil, fmt.Errorf("at least %d shares are needed", minimum)
+	}
+
+	// Exactly minimum shares determine the polynomials
+	shares = shares[:minimum]
+	shareLen := len(shares[0])
+	if shareLen < 2 {
+		return nil, fmt.Errorf("shares must be at least two bytes")
+	}
+
+	x_samples := make([]uint8, minimum)
+	checkMap := map[byte]bool{}
+	for i, share := range shares {
+		if len(share) != shareLen {
+			return nil, fmt.Errorf("all shares must be the same length")
+		}
+
+		samp := share[shareLen-1]
+		if exists := checkMap[samp]; exists {
+			return nil, fmt.Errorf("duplicate share detected")
+		}
+		checkMap[samp] = true
+		x_samples[i] = samp
+	}
+
+	// The Lagrange basis polynomials only depend on the x coordinates,
+	// so their coefficients are computed once for all blocks
+	basis := lagrangeBasis(x_samples)
+	hidden, size, blocks := privacy-1, minimum-privacy+1, shareLen-1
+	data := make([]byte, blocks*size)
+	for block := 0; block < blocks; block++ {
+		for d := 0; d < size; d++ {
+			var coeff uint8
+			for i, share := range shares {
+				coeff = add(coeff, mult(share[block], basis[i][hidden+d]))
+			}
+			data[block*size+d] = coeff
+		}
+	}
+	return data, nil
+}
+
+// lagrangeBasis returns the coefficients of the Lagrange basis polynomials
+// for the given x coordinates: basis[i][d] is the coefficient of x^d
+// of the polynomial that is 1 at x_samples[i] and 0 at the others.
+func lagrangeBasis(x_samples []uint8) [][]uint8 {
+	limit := len(x_samples)
+
+	// The product of (x - x_j) for all j (subtraction is addition)
+	all := []uint8{1}
+	for _, xj := range x_samples {
+		next := make([]uint8, len(all)+1)
+		for d, c := range all {
+			next[d+1] = add(next[d+1], c)
+			next[d] = add(next[d], mult(c, xj))
+		}
+		all = next
+	}
+
+	basis := make([][]uint8, limit)
+	for i, xi := range x_samples {
+		// Divide out (x - x_i) by synthetic division
+		num := make([]uint8, limit)
+		carry := uint8(0)
+		for d := limit; d > 0; d-- {
+			carry = add(all[d], mult(carry, xi))
+			num[d-1] = carry
+		}
+
+		// Evaluate at x_i for the denominator
+		var denom uint8
+		for d := limit - 1; d >= 0; d-- {
+			denom = add(mult(denom, xi), num[d])
+		}
+
+		basis[i] = make([]uint8, limit)
+		for d := range num {
+			basis[i][d] = div(num[d], denom)
+		}
+	}
+	return basis
+}
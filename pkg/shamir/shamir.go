@@ -1,13 +1,17 @@
 // After https://github.com/hashicorp/vault/blob/master/shamir/shamir.go
 
+// Package shamir implements Shamir's secret sharing over GF(2^8) (Split, Combine),
+// over GF(2^16) for more than 255 shares (Split16, Combine16), in bulk for large
+// data (SplitBulk, CombineBulk) and as a ramp scheme (SplitRamp, CombineRamp).
+// The field arithmetic is exported as Element, Polynomial, Point and Share,
+// for building other schemes on top of it.
 package shamir
 
 import (
 	"crypto/rand"
-	"crypto/subtle"
+	"encoding/binary"
 	"fmt"
-	mrand "math/rand"
-	"time"
+	"io"
 )
 
 const (
@@ -23,8 +27,9 @@ type polynomial struct {
 }
 
 // makePolynomial constructs a random polynomial of the given
-// degree but with the provided intercept value.
-func makePolynomial(intercept, degree uint8) (polynomial, error) {
+// degree but with the provided intercept value, drawing the
+// coefficients from random.
+func makePolynomial(random io.Reader, intercept, degree uint8) (polynomial, error) {
 	// Create a wrapper
 	p := polynomial{
 		coefficients: make([]byte, degree+1),
@@ -34,7 +39,7 @@ func makePolynomial(intercept, degree uint8) (polynomial, error) {
 	p.coefficients[0] = intercept
 
 	// Assign random co-efficients to the polynomial
-	if _, err := rand.Read(p.coefficients[1:]); err != nil {
+	if _, err := io.ReadFull(random, p.coefficients[1:]); err != nil {
 		return p, err
 	}
 
@@ -80,7 +85,7 @@ func interpolatePolynomial(x_samples, y_samples []uint8, x uint8) uint8 {
 	return result
 }
 
-// div divides two numbers in GF(2^8)
+// div divides two numbers in GF(2^8) in constant time
 func div(a, b uint8) uint8 {
 	if b == 0 {
 		// leaks some timing information but we don't care anyways as this
@@ -88,52 +93,39 @@ func div(a, b uint8) uint8 {
 		panic("divide by zero")
 	}
 
-	var goodVal, zero uint8
-	log_a := logTable[a]
-	log_b := logTable[b]
-	diff := (int(log_a) - int(log_b)) % 255
-	if diff < 0 {
-		diff += 255
-	}
-
-	ret := expTable[diff]
-
-	// Ensure we return zero if a is zero but aren't subject to timing attacks
-	goodVal = ret
-
-	if subtle.ConstantTimeByteEq(a, 0) == 1 {
-		ret = zero
-	} else {
-		ret = goodVal
-	}
-
-	return ret
+	return mult(a, inverse(b))
 }
 
-// mult multiplies two numbers in GF(2^8)
-func mult(a, b uint8) (out uint8) {
-	var goodVal, zero uint8
-	log_a := logTable[a]
-	log_b := logTable[b]
-	sum := (int(log_a) + int(log_b)) % 255
-
-	ret := expTable[sum]
-
-	// Ensure we return zero if either a or b are zero but aren't subject to
-	// timing attacks
-	goodVal = ret
-
-	if subtle.ConstantTimeByteEq(a, 0) == 1 {
-		ret = zero
-	} else {
-		ret = goodVal
-	}
+// inverse returns the multiplicative inverse in GF(2^8) in constant time:
+// a^254, as a^255 is 1 for every non-zero a (the inverse of 0 comes out as 0)
+func inverse(a uint8) uint8 {
+	// Square-and-multiply over the fixed exponent 254 (binary 11111110)
+	a2 := mult(a, a)
+	a3 := mult(a2, a)
+	a6 := mult(a3, a3)
+	a7 := mult(a6, a)
+	a14 := mult(a7, a7)
+	a15 := mult(a14, a)
+	a30 := mult(a15, a15)
+	a31 := mult(a30, a)
+	a62 := mult(a31, a31)
+	a63 := mult(a62, a)
+	a126 := mult(a63, a63)
+	a127 := mult(a126, a)
+	return mult(a127, a127)
+}
 
-	if subtle.ConstantTimeByteEq(b, 0) == 1 {
-		ret = zero
+// mult multiplies two numbers in GF(2^8) (modulo x^8 + x^4 + x^3 + x + 1)
+// in constant time: shift-and-add over all bits of b, without tables or
+// branches on the values, so nothing leaks through cache or branch timing
+func mult(a, b uint8) uint8 {
+	var out uint8
+	for i := uint8(8); i > 0; i-- {
+		// Multiply by x, reducing when the top bit falls out,
+		// and add a when bit i-1 of b is set
+		out = out<<1 ^ -(out>>7)&0x1b ^ -(b>>(i-1)&1)&a
 	}
-
-	return ret
+	return out
 }
 
 // add combines two numbers in GF(2^8)
@@ -148,6 +140,14 @@ func add(a, b uint8) uint8 {
 // than 256. The returned shares are each one byte longer than the key
 // as they attach a tag used to reconstruct the key.
 func Split(key []byte, number, minimum int) ([][]byte, error) {
+	return SplitReader(rand.Reader, key, number, minimum)
+}
+
+// SplitReader is Split drawing the x coordinates and the coefficients
+// from random instead of crypto/rand, so the shares can be reproduced
+// (for known-answer tests). Only use a cryptographically secure source
+// for real secrets.
+func SplitReader(random io.Reader, key []byte, number, minimum int) ([][]byte, error) {
 	// Sanity check the input
 	if number < minimum {
 		return nil, fmt.Errorf("number cannot be less than minimum")
@@ -167,8 +167,10 @@ func Split(key []byte, number, minimum int) ([][]byte, error) {
 	}
 
 	// Generate random list of x coordinates
-	mrand.Seed(time.Now().UnixNano())
-	xCoordinates := mrand.Perm(255)
+	xCoordinates, err := randomCoordinates(random, number, 255)
+	if err != nil {
+		return nil, err
+	}
 
 	// Allocate the output array, initialize the final byte
 	// of the output with the offset. The representation of each
@@ -176,7 +178,7 @@ func Split(key []byte, number, minimum int) ([][]byte, error) {
 	out := make([][]byte, number)
 	for idx := range out {
 		out[idx] = make([]byte, len(key)+1)
-		out[idx][len(key)] = uint8(xCoordinates[idx]) + 1
+		out[idx][len(key)] = uint8(xCoordinates[idx])
 	}
 
 	// Construct a random polynomial for each byte of the key.
@@ -184,7 +186,7 @@ func Split(key []byte, number, minimum int) ([][]byte, error) {
 	// a single byte as the intercept of the polynomial, so we must
 	// use a new polynomial for each byte.
 	for idx, val := range key {
-		p, err := makePolynomial(val, uint8(minimum-1))
+		p, err := makePolynomial(random, val, uint8(minimum-1))
 		if err != nil {
 			return nil, err
 		}
@@ -193,7 +195,7 @@ func Split(key []byte, number, minimum int) ([][]byte, error) {
 		// We cheat by encoding the x value once as the final index,
 		// so that it only needs to be stored once.
 		for i := 0; i < number; i++ {
-			x := uint8(xCoordinates[i]) + 1
+			x := uint8(xCoordinates[i])
 			y := p.evaluate(x)
 			out[i][idx] = y
 		}
@@ -203,9 +205,69 @@ func Split(key []byte, number, minimum int) ([][]byte, error) {
 	return out, nil
 }
 
+// randomCoordinates returns `count` distinct x coordinates in 1..size drawn
+// from random, the start of a random permutation (by Fisher-Yates).
+func randomCoordinates(random io.Reader, count, size int) ([]int, error) {
+	if count > size {
+		return nil, fmt.Errorf("cannot choose %d coordinates out of %d", count, size)
+	}
+
+	perm := make([]int, size)
+	for i := range perm {
+		perm[i] = i + 1
+	}
+	for i := 0; i < count; i++ {
+		j, err := uniform(random, size-i)
+		if err != nil {
+			return nil, err
+		}
+
+		perm[i], perm[i+j] = perm[i+j], perm[i]
+	}
+	return perm[:count], nil
+}
+
+// uniform returns a uniformly distributed number in 0..n-1 drawn from random
+// (rejecting the values that would bias the result).
+func uniform(random io.Reader, n int) (int, error) {
+	limit := (1 << 32) - (1<<32)%uint64(n)
+	b := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(random, b); err != nil {
+			return 0, err
+		}
+
+		if v := uint64(binary.BigEndian.Uint32(b)); v < limit {
+			return int(v % uint64(n)), nil
+		}
+	}
+}
+
 // Combine is used to reverse a Split and reconstruct a key
 // once a `minimum` number of keyparts are available.
 func Combine(keyparts [][]byte) ([]byte, error) {
+	return interpolateKeyparts(keyparts, 0)
+}
+
+// Evaluate is used to issue an extra keypart for the given x coordinate
+// once a `minimum` number of keyparts are available. The new keypart lies
+// on the same polynomials, so it can be combined with the existing ones.
+func Evaluate(keyparts [][]byte, x uint8) ([]byte, error) {
+	if x == 0 {
+		return nil, fmt.Errorf("x coordinate cannot be zero")
+	}
+
+	keypart, err := interpolateKeyparts(keyparts, x)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(keypart, x), nil
+}
+
+// interpolateKeyparts returns the values of the polynomials
+// behind the keyparts at the given x coordinate.
+func interpolateKeyparts(keyparts [][]byte, x uint8) ([]byte, error) {
 	//// Not technically required
 	// Verify enough keyparts provided
 	//if len(keyparts) < 2 {
@@ -249,11 +311,85 @@ func Combine(keyparts [][]byte) ([]byte, error) {
 			y_samples[i] = keypart[idx]
 		}
 
-		// Interpolate the polynomial and compute the value at 0
-		val := interpolatePolynomial(x_samples, y_samples, 0)
+		// Interpolate the polynomial and compute the value at x
+		val := interpolatePolynomial(x_samples, y_samples, x)
 
-		// Evaluate the 0th value to get the intercept
+		// Evaluate the value at x (the intercept when x is 0)
 		key[idx] = val
 	}
 	return key, nil
 }
+
+// RefreshUpdates generates the sub-updates a holder hands out in a round
+// of proactive refresh: for each byte of the keyparts a random polynomial
+// with a zero intercept is evaluated at each of the given x coordinates.
+// The returned sub-updates have the same format as keyparts of the given
+// length, the one for xCoordinates[i] at index i.
+func RefreshUpdates(length, minimum int, xCoordinates []uint8) ([][]byte, error) {
+	return RefreshUpdatesReader(rand.Reader, length, minimum, xCoordinates)
+}
+
+// RefreshUpdatesReader is RefreshUpdates drawing the coefficients from
+// random instead of crypto/rand. Only use a cryptographically secure source
+// for real secrets.
+func RefreshUpdatesReader(random io.Reader, length, minimum int, xCoordinates []uint8) ([][]byte, error) {
+	if minimum < 1 || minimum > 255 {
+		return nil, fmt.Errorf("minimum must be between 1 and 255")
+	}
+
+	if length < 1 {
+		return nil, fmt.Errorf("cannot refresh empty keyparts")
+	}
+
+	checkMap := map[byte]bool{}
+	out := make([][]byte, len(xCoordinates))
+	for idx, x := range xCoordinates {
+		if x == 0 || checkMap[x] {
+			return nil, fmt.Errorf("x coordinates must be unique and not zero")
+		}
+		checkMap[x] = true
+		out[idx] = make([]byte, length+1)
+		out[idx][length] = x
+	}
+
+	// Because the intercepts are zero, adding the updates to the keyparts
+	// leaves the key unchanged but moves every keypart to a new polynomial.
+	for idx := 0; idx < length; idx++ {
+		p, err := makePolynomial(random, 0, uint8(minimum-1))
+		if err != nil {
+			return nil, err
+		}
+
+		for i, x := range xCoordinates {
+			out[i][idx] = p.evaluate(x)
+		}
+	}
+	return out, nil
+}
+
+// ApplyRefresh adds the sub-updates of all holders for this keypart
+// to it. Every holder has to apply the sub-updates of the same holders,
+// after that the old keyparts can't be combined with the new ones.
+func ApplyRefresh(keypart []byte, updates [][]byte) ([]byte, error) {
+	length := len(keypart)
+	if length < 2 {
+		return nil, fmt.Errorf("keypart must be at least two bytes")
+	}
+
+	out := make([]byte, length)
+	copy(out, keypart)
+	for _, update := range updates {
+		if len(update) != length {
+			return nil, fmt.Errorf("sub-update must be the same length as the keypart")
+		}
+
+		if update[length-1] != keypart[length-1] {
+			return nil, fmt.Errorf("sub-update is for a different keypart")
+		}
+
+		for idx := 0; idx < length-1; idx++ {
+			out[idx] = add(out[idx], update[idx])
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,175 @@
+package shamir
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// The GF(2^16) field allows up to 65535 shares. Its elements are
+// pairs of bytes (big-endian), reduced by the primitive polynomial
+// x^16 + x^12 + x^3 + x + 1. Like in GF(2^8) the arithmetic is constant-time.
+
+const (
+	// ShareOverhead16 is the byte size overhead of each share
+	// when using Split16 on a key: a two byte tag.
+	ShareOverhead16 = 2
+
+	poly16 = 0x1100b
+)
+
+// mult16 multiplies two numbers in GF(2^16) in constant time:
+// shift-and-add over all bits of b, without tables or branches on the values
+func mult16(a, b uint16) uint16 {
+	var out uint16
+	for i := uint16(16); i > 0; i-- {
+		// Multiply by x, reducing when the top bit falls out,
+		// and add a when bit i-1 of b is set
+		out = out<<1 ^ -(out>>15)&(poly16&0xffff) ^ -(b>>(i-1)&1)&a
+	}
+	return out
+}
+
+// inverse16 returns the multiplicative inverse in GF(2^16) in constant time:
+// a^65534, as a^65535 is 1 for every non-zero a (the inverse of 0 comes out as 0)
+func inverse16(a uint16) uint16 {
+	// Square-and-multiply over the fixed exponent 65534 (fifteen ones and a zero)
+	out := a
+	for i := 0; i < 14; i++ {
+		out = mult16(mult16(out, out), a)
+	}
+	return mult16(out, out)
+}
+
+// div16 divides two numbers in GF(2^16) in constant time
+func div16(a, b uint16) uint16 {
+	if b == 0 {
+		panic("divide by zero")
+	}
+
+	return mult16(a, inverse16(b))
+}
+
+// evaluate16 returns the value at x of the polynomial with the given
+// coefficients (lowest degree first) using Horner's method
+func evaluate16(coefficients []uint16, x uint16) uint16 {
+	degree := len(coefficients) - 1
+	out := coefficients[degree]
+	for i := degree - 1; i >= 0; i-- {
+		out = mult16(out, x) ^ coefficients[i]
+	}
+	return out
+}
+
+// Split16 is Split over GF(2^16): it takes a key of an even number of bytes
+// and generates a `number` number of shares (up to 65535), `minimum` of which
+// are required to reconstruct the key. The returned shares are each two bytes
+// longer than the key as they attach a tag used to reconstruct the key.
+func Split16(key []byte, number, minimum int) ([][]byte, error) {
+	return Split16Reader(rand.Reader, key, number, minimum)
+}
+
+// Split16Reader is Split16 drawing the x coordinates and the coefficients
+// from random instead of crypto/rand (see SplitReader).
+func Split16Reader(random io.Reader, key []byte, number, minimum int) ([][]byte, error) {
+	if number < minimum {
+		return nil, fmt.Errorf("number cannot be less than minimum")
+	}
+
+	if number > 65535 {
+		return nil, fmt.Errorf("number cannot exceed 65535")
+	}
+
+	if minimum < 1 {
+		return nil, fmt.Errorf("minimum must be at least 1")
+	}
+
+	if len(key) == 0 || len(key)%2 != 0 {
+		return nil, fmt.Errorf("key must be a non-zero even number of bytes")
+	}
+
+	// Generate random list of x coordinates
+	xCoordinates, err := randomCoordinates(random, number, 65535)
+	if err != nil {
+		return nil, err
+	}
+
+	// The representation of each output is {y1, y2, .., yN, x},
+	// all of them two bytes
+	out := make([][]byte, number)
+	for idx := range out {
+		out[idx] = make([]byte, len(key)+ShareOverhead16)
+		binary.BigEndian.PutUint16(out[idx][len(key):], uint16(xCoordinates[idx]))
+	}
+
+	coeffs := make([]byte, 2*(minimum-1))
+	coefficients := make([]uint16, minimum)
+	for idx := 0; idx < len(key); idx += 2 {
+		if _, err := io.ReadFull(random, coeffs); err != nil {
+			return nil, err
+		}
+
+		coefficients[0] = binary.BigEndian.Uint16(key[idx:])
+		for i := 1; i < minimum; i++ {
+			coefficients[i] = binary.BigEndian.Uint16(coeffs[2*(i-1):])
+		}
+		for i := 0; i < number; i++ {
+			x := uint16(xCoordinates[i])
+			binary.BigEndian.PutUint16(out[i][idx:], evaluate16(coefficients, x))
+		}
+	}
+	return out, nil
+}
+
+// Combine16 is used to reverse a Split16 and reconstruct a key
+// once a `minimum` number of keyparts are available.
+func Combine16(keyparts [][]byte) ([]byte, error) {
+	if len(keyparts) == 0 {
+		return nil, fmt.Errorf("no keyparts to combine")
+	}
+
+	partLen := len(keyparts[0])
+	if partLen < 4 || partLen%2 != 0 {
+		return nil, fmt.Errorf("keyparts must be an even number of bytes, at least four")
+	}
+
+	x_samples := make([]uint16, len(keyparts))
+	checkMap := map[uint16]bool{}
+	for i, keypart := range keyparts {
+		if len(keypart) != partLen {
+			return nil, fmt.Errorf("all keyparts must be the same length")
+		}
+
+		samp := binary.BigEndian.Uint16(keypart[partLen-ShareOverhead16:])
+		if samp == 0 || checkMap[samp] {
+			return nil, fmt.Errorf("duplicate or zero keypart detected")
+		}
+		checkMap[samp] = true
+		x_samples[i] = samp
+	}
+
+	// The Lagrange basis values at 0 only depend on the x coordinates,
+	// one division each keeps this quadratic in multiplications only
+	basis := make([]uint16, len(keyparts))
+	for i := range basis {
+		num, denom := uint16(1), uint16(1)
+		for j := range x_samples {
+			if i != j {
+				num = mult16(num, x_samples[j])
+				denom = mult16(denom, x_samples[i]^x_samples[j])
+			}
+		}
+		basis[i] = div16(num, denom)
+	}
+
+	key := make([]byte, partLen-ShareOverhead16)
+	for idx := 0; idx < len(key); idx += 2 {
+		var val uint16
+		for i, keypart := range keyparts {
+			val ^= mult16(binary.BigEndian.Uint16(keypart[idx:]), basis[i])
+		}
+		binary.BigEndian.PutUint16(key[idx:], val)
+	}
+	return key, nil
+}
@@ -0,0 +1,518 @@
+package shamir
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"runtime"
+	"testing"
+)
+
+// multTable multiplies two numbers in GF(2^8) with the log/exp tables
+func multTable(a, b uint8) uint8 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+
+	return expTable[(int(logTable[a])+int(logTable[b]))%255]
+}
+
+// divTable divides two numbers in GF(2^8) with the log/exp tables
+func divTable(a, b uint8) uint8 {
+	if a == 0 {
+		return 0
+	}
+
+	diff := (int(logTable[a]) - int(logTable[b])) % 255
+	if diff < 0 {
+		diff += 255
+	}
+	return expTable[diff]
+}
+
+func TestMult(t *testing.T) {
+	for a := 0; a < 256; a++ {
+		for b := 0; b < 256; b++ {
+			if got, want := mult(uint8(a), uint8(b)), multTable(uint8(a), uint8(b)); got != want {
+				t.Fatalf("mult(%d, %d) = %d, tables give %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestDiv(t *testing.T) {
+	for a := 0; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			if got, want := div(uint8(a), uint8(b)), divTable(uint8(a), uint8(b)); got != want {
+				t.Fatalf("div(%d, %d) = %d, tables give %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestDivByZero(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("div by zero did not panic")
+		}
+	}()
+	div(1, 0)
+}
+
+func TestInverse(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		if got := mult(uint8(a), inverse(uint8(a))); got != 1 {
+			t.Fatalf("%d * inverse(%d) = %d", a, a, got)
+		}
+	}
+}
+
+// logTable16, expTable16 are the log and exp tables of GF(2^16), generated
+// from the primitive polynomial with generator 2
+var logTable16, expTable16 = func() (*[65536]uint16, *[65535]uint16) {
+	logs, exps := new([65536]uint16), new([65535]uint16)
+	x := uint32(1)
+	for i := range exps {
+		exps[i] = uint16(x)
+		logs[x] = uint16(i)
+		x <<= 1
+		if x&0x10000 != 0 {
+			x ^= poly16
+		}
+	}
+	return logs, exps
+}()
+
+// multTable16 multiplies two numbers in GF(2^16) with the log/exp tables
+func multTable16(a, b uint16) uint16 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+
+	return expTable16[(int(logTable16[a])+int(logTable16[b]))%65535]
+}
+
+// samples16 returns a spread of GF(2^16) elements including the edge cases
+func samples16() []uint16 {
+	samples := []uint16{0, 1, 2, 3, 0x100b, 0x7fff, 0x8000, 0xfffe, 0xffff}
+	for a := uint32(5); a < 65536; a += 997 {
+		samples = append(samples, uint16(a))
+	}
+	return samples
+}
+
+func TestMult16(t *testing.T) {
+	for _, a := range samples16() {
+		for b := 0; b < 65536; b += 7 {
+			if got, want := mult16(a, uint16(b)), multTable16(a, uint16(b)); got != want {
+				t.Fatalf("mult16(%d, %d) = %d, tables give %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestDiv16(t *testing.T) {
+	for _, a := range samples16() {
+		for _, b := range samples16()[1:] {
+			got := div16(a, b)
+			if mult16(got, b) != a {
+				t.Fatalf("div16(%d, %d) = %d, times %d is not %d", a, b, got, b, a)
+			}
+		}
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("div16 by zero did not panic")
+		}
+	}()
+	div16(1, 0)
+}
+
+func TestInverse16(t *testing.T) {
+	for a := 1; a < 65536; a++ {
+		if got := mult16(uint16(a), inverse16(uint16(a))); got != 1 {
+			t.Fatalf("%d * inverse16(%d) = %d", a, a, got)
+		}
+	}
+}
+
+func TestInterpolatePolynomial(t *testing.T) {
+	for _, coeffs := range [][]uint8{{42}, {0, 1}, {7, 0, 255}, {1, 2, 3, 4, 5}} {
+		p := polynomial{coefficients: coeffs}
+		xs := make([]uint8, len(coeffs))
+		ys := make([]uint8, len(coeffs))
+		for i := range xs {
+			xs[i] = uint8(3*i + 1)
+			ys[i] = p.evaluate(xs[i])
+		}
+		for x := 0; x < 256; x++ {
+			if got, want := interpolatePolynomial(xs, ys, uint8(x)), p.evaluate(uint8(x)); got != want {
+				t.Fatalf("interpolation of %v at %d = %d, want %d", coeffs, x, got, want)
+			}
+		}
+	}
+}
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("test secret for the shamir package")
+	for _, tc := range []struct{ n, m int }{{1, 1}, {2, 2}, {5, 3}, {255, 10}} {
+		parts, err := Split(secret, tc.n, tc.m)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, subset := range [][][]byte{parts[:tc.m], parts[tc.n-tc.m:], parts} {
+			got, err := Combine(subset)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(got, secret) {
+				t.Fatalf("%d of %d: combined %q", tc.m, tc.n, got)
+			}
+		}
+	}
+}
+
+func BenchmarkMult(b *testing.B) {
+	var out uint8
+	for i := 0; i < b.N; i++ {
+		out ^= mult(uint8(i), uint8(i>>8))
+	}
+	_ = out
+}
+
+func BenchmarkMultTable(b *testing.B) {
+	var out uint8
+	for i := 0; i < b.N; i++ {
+		out ^= multTable(uint8(i), uint8(i>>8))
+	}
+	_ = out
+}
+
+func BenchmarkDiv(b *testing.B) {
+	var out uint8
+	for i := 0; i < b.N; i++ {
+		out ^= div(uint8(i), uint8(i>>8)|1)
+	}
+	_ = out
+}
+
+func BenchmarkDivTable(b *testing.B) {
+	var out uint8
+	for i := 0; i < b.N; i++ {
+		out ^= divTable(uint8(i), uint8(i>>8)|1)
+	}
+	_ = out
+}
+
+func BenchmarkCombine(b *testing.B) {
+	parts, err := Split(make([]byte, 32), 10, 5)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Combine(parts[:5]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// streamReader is a deterministic source of bytes for known-answer tests:
+// the SHA-256 of the seed and a counter, block after block
+type streamReader struct {
+	seed    string
+	counter uint64
+	buf     []byte
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.buf) < len(p) {
+		sum := sha256.Sum256(binary.BigEndian.AppendUint64([]byte(r.seed), r.counter))
+		r.buf = append(r.buf, sum[:]...)
+		r.counter++
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// TestSplitByHand checks a vector that can be worked out by hand: zero draws
+// give x coordinates 1 and 2, the coefficients are 3 and 5, so the shares
+// of the bytes 1 and 2 lie on 1+3x and 2+5x (3*2 = 6 and 5*2 = 10 in GF(2^8))
+func TestSplitByHand(t *testing.T) {
+	random := bytes.NewReader([]byte{0, 0, 0, 0, 0, 0, 0, 0, 3, 5})
+	parts, err := SplitReader(random, []byte{1, 2}, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]byte{{1 ^ 3, 2 ^ 5, 1}, {1 ^ 6, 2 ^ 10, 2}}
+	for i := range want {
+		if !bytes.Equal(parts[i], want[i]) {
+			t.Errorf("share %d: got %x, want %x", i+1, parts[i], want[i])
+		}
+	}
+}
+
+// Known answers, with the SHA-256 stream of "horcrux" as randomness
+var katTests = []struct {
+	name   string
+	split  func([]byte) ([][]byte, error)
+	secret string
+	shares []string
+}{
+	{"Split", func(secret []byte) ([][]byte, error) {
+		return SplitReader(&streamReader{seed: "horcrux"}, secret, 5, 3)
+	}, "horcrux", []string{"8e1ee47c308a094e", "2260fc055a4d2ef6", "969ae608ebb89a04", "e1ece0fd7821d177", "4f0b8ba7b51d64a0"}},
+	{"Split16", func(secret []byte) ([][]byte, error) {
+		return Split16Reader(&streamReader{seed: "horcrux"}, secret, 3, 2)
+	}, "horcrux!", []string{"4de99575ace17951ce7f", "f7a95fcab06d477c9cbe", "21754dc11eaa56751a81"}},
+	{"SplitRamp", func(secret []byte) ([][]byte, error) {
+		return SplitRampReader(&streamReader{seed: "horcrux"}, secret, 4, 3, 2)
+	}, "horcrux ramp", []string{"ff468636f8d24e", "981528adea94f6", "b29d7be6e61604", "13c5fc61178777"}},
+}
+
+func TestKnownAnswers(t *testing.T) {
+	for _, kat := range katTests {
+		parts, err := kat.split([]byte(kat.secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, part := range parts {
+			if got := hex.EncodeToString(part); got != kat.shares[i] {
+				t.Errorf("%s share %d: got %s, want %s", kat.name, i+1, got, kat.shares[i])
+			}
+		}
+	}
+
+	if got, err := Combine(decodeShares(katTests[0].shares[2:])); err != nil || string(got) != katTests[0].secret {
+		t.Errorf("Combine: got %q (%v)", got, err)
+	}
+
+	if got, err := Combine16(decodeShares(katTests[1].shares[1:])); err != nil || string(got) != katTests[1].secret {
+		t.Errorf("Combine16: got %q (%v)", got, err)
+	}
+
+	if got, err := CombineRamp(decodeShares(katTests[2].shares[1:]), 3, 2); err != nil || string(got) != katTests[2].secret {
+		t.Errorf("CombineRamp: got %q (%v)", got, err)
+	}
+}
+
+// decodeShares decodes hex shares
+func decodeShares(hexes []string) [][]byte {
+	shares := make([][]byte, len(hexes))
+	for i, h := range hexes {
+		shares[i], _ = hex.DecodeString(h)
+	}
+	return shares
+}
+
+func TestBulk(t *testing.T) {
+	data := make([]byte, 3*bulkChunk+123)
+	(&streamReader{seed: "bulk"}).Read(data)
+	for _, tc := range []struct{ n, m int }{{1, 1}, {3, 2}, {5, 5}, {20, 7}} {
+		parts, err := SplitBulk(data, tc.n, tc.m)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := CombineBulk(parts[tc.n-tc.m:])
+		if err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("%d of %d: CombineBulk of SplitBulk differs (%v)", tc.m, tc.n, err)
+		}
+
+		// The shares are interchangeable with those of Split and Combine
+		parts, err = SplitBulk(data[:1000], tc.n, tc.m)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err = Combine(parts[:tc.m])
+		if err != nil || !bytes.Equal(got, data[:1000]) {
+			t.Fatalf("%d of %d: Combine of SplitBulk differs (%v)", tc.m, tc.n, err)
+		}
+
+		parts, err = Split(data[:1000], tc.n, tc.m)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err = CombineBulk(parts[:tc.m])
+		if err != nil || !bytes.Equal(got, data[:1000]) {
+			t.Fatalf("%d of %d: CombineBulk of Split differs (%v)", tc.m, tc.n, err)
+		}
+	}
+}
+
+// TestBulkKnownAnswer checks the SHA-256 of the shares of data spanning several
+// batches of coefficients, they only depend on the randomness, not on the cores
+func TestBulkKnownAnswer(t *testing.T) {
+	data := make([]byte, 2*bulkBatch+bulkChunk+7)
+	(&streamReader{seed: "bulk"}).Read(data)
+	want := []string{
+		"9c456f61508a92817a78473604caace7a0159a7bb3ff02d78a8571b769a61de9",
+		"a302e713b7ae4bc6635f31ab5c526e37b44921be7be61fd2b24c0f35052e6acf",
+		"2825611db8b07079f0ab605468cd356ee74a785d7e9107b79a3bff421b3c68f0",
+	}
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(0))
+	for _, procs := range []int{1, 3, 8} {
+		runtime.GOMAXPROCS(procs)
+		parts, err := SplitBulkReader(&streamReader{seed: "horcrux"}, data, 3, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for i, part := range parts {
+			sum := sha256.Sum256(part)
+			if got := hex.EncodeToString(sum[:]); got != want[i] {
+				t.Errorf("%d cores, share %d: got SHA-256 %s, want %s", procs, i+1, got, want[i])
+			}
+		}
+	}
+}
+
+func BenchmarkSplitBulk(b *testing.B) {
+	data := make([]byte, 16<<20)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if _, err := SplitBulk(data, 5, 3); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCombineBulk(b *testing.B) {
+	parts, err := SplitBulk(make([]byte, 16<<20), 5, 3)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(parts[0]) - 1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := CombineBulk(parts[:3]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestElement(t *testing.T) {
+	for a := 0; a < 256; a++ {
+		ea := Element(a)
+		if ea.Add(ea) != 0 {
+			t.Fatalf("%d + %d is not 0", a, a)
+		}
+
+		for b := 1; b < 256; b++ {
+			eb := Element(b)
+			if ea.Mul(eb).Div(eb) != ea {
+				t.Fatalf("%d * %d / %d is not %d", a, b, b, a)
+			}
+		}
+		if a > 0 && ea.Mul(ea.Inv()) != 1 {
+			t.Fatalf("%d * %d.Inv() is not 1", a, a)
+		}
+	}
+}
+
+func TestPolynomialInterpolate(t *testing.T) {
+	p, err := NewPolynomial(&streamReader{seed: "polynomial"}, 42, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p) != 4 || p.Evaluate(0) != 42 {
+		t.Fatalf("polynomial %v should have degree 3 and intercept 42", p)
+	}
+
+	points := []Point{}
+	for x := Element(1); x <= 4; x++ {
+		points = append(points, Point{x, p.Evaluate(x)})
+	}
+	for x := 0; x < 256; x++ {
+		got, err := Interpolate(points, Element(x))
+		if err != nil || got != p.Evaluate(Element(x)) {
+			t.Fatalf("interpolation at %d: got %d (%v), want %d", x, got, err, p.Evaluate(Element(x)))
+		}
+	}
+	if _, err := Interpolate(append(points, points[0]), 0); err == nil {
+		t.Fatal("duplicate points were accepted")
+	}
+}
+
+func TestShares(t *testing.T) {
+	secret := []byte("shares with explicit coordinates")
+	shares, err := SplitShares(nil, secret, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := CombineShares(shares[2:])
+	if err != nil || !bytes.Equal(got, secret) {
+		t.Fatalf("CombineShares: got %q (%v)", got, err)
+	}
+
+	share, err := ParseShare(shares[0].Bytes())
+	if err != nil || share.X != shares[0].X || !bytes.Equal(share.Y, shares[0].Y) {
+		t.Fatalf("ParseShare of Bytes: got %v (%v), want %v", share, err, shares[0])
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	key := []byte("a key that is refreshed")
+	keyparts, err := SplitReader(&streamReader{seed: "refresh"}, key, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	xs := make([]uint8, len(keyparts))
+	for i, keypart := range keyparts {
+		xs[i] = keypart[len(keypart)-1]
+	}
+	// Every holder hands out sub-updates to all of them
+	updates := make([][][]byte, len(keyparts))
+	for i := range keyparts {
+		updates[i], err = RefreshUpdatesReader(&streamReader{seed: "holder" + string(rune('0'+i))}, len(key), 3, xs)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	refreshed := make([][]byte, len(keyparts))
+	for i, keypart := range keyparts {
+		received := make([][]byte, len(updates))
+		for j := range updates {
+			received[j] = updates[j][i]
+		}
+		refreshed[i], err = ApplyRefresh(keypart, received)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if bytes.Equal(refreshed[i], keypart) {
+			t.Errorf("keypart %d didn't change", i)
+		}
+	}
+	for _, subset := range [][][]byte{refreshed[:3], refreshed[2:], {refreshed[0], refreshed[2], refreshed[4]}} {
+		got, err := Combine(subset)
+		if err != nil || !bytes.Equal(got, key) {
+			t.Errorf("Combine of refreshed keyparts: got %q (%v), want %q", got, err, key)
+		}
+	}
+	got, err := Combine([][]byte{keyparts[0], keyparts[1], refreshed[2]})
+	if err == nil && bytes.Equal(got, key) {
+		t.Error("old and refreshed keyparts combined to the key")
+	}
+
+	if _, err := ApplyRefresh(keyparts[0], [][]byte{updates[0][1]}); err == nil {
+		t.Error("a sub-update for a different keypart was applied")
+	}
+
+	if _, err := RefreshUpdates(len(key), 3, []uint8{1, 1}); err == nil {
+		t.Error("duplicate x coordinates were accepted")
+	}
+}
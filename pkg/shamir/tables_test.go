@@ -4,6 +4,8 @@ package shamir
 
 // Tables taken from http://www.samiam.org/galois.html
 // They use 0xe5 (229) as the generator
+// The arithmetic no longer uses them (indexing them with secret bytes leaks
+// through cache timing), the tests check the constant-time arithmetic against them
 
 var (
 	// logTable provides the log(X)/log(g) at each index X